@@ -0,0 +1,188 @@
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/slink-go/logging"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval limits client certificate files change checks (made on TLS handshake)
+var reloadCheckInterval = 5 * time.Second
+
+// ClientSettings configures TLS connections to upstream services
+type ClientSettings struct {
+	CAFile             string // CA bundle to verify upstream certificates (default - system CAs)
+	CertFile           string // client certificate (mTLS)
+	KeyFile            string // client certificate key (mTLS)
+	ServerName         string // SNI server name override (also used for certificate verification)
+	SkipVerifyHostname bool   // verify certificate chain, but not server name
+	InsecureSkipVerify bool   // do not verify upstream certificates at all
+}
+
+// IsZero checks if settings are default (system CAs, no client certificate)
+func (s ClientSettings) IsZero() bool {
+	return s == ClientSettings{}
+}
+
+// String returns settings key (e.g. for transport caching)
+func (s ClientSettings) String() string {
+	return fmt.Sprintf("ca=%s;cert=%s;key=%s;sni=%s;skip-hostname=%v;insecure=%v",
+		s.CAFile, s.CertFile, s.KeyFile, s.ServerName, s.SkipVerifyHostname, s.InsecureSkipVerify)
+}
+
+// ClientConfig creates TLS configs for upstream connections; CA and client certificate files are reloaded on change
+type ClientConfig struct {
+	settings ClientSettings
+	files    *clientFiles
+}
+
+func NewClientConfig(settings ClientSettings) (*ClientConfig, error) {
+	if (settings.CertFile == "") != (settings.KeyFile == "") {
+		return nil, errors.New("both client certificate and key files should be set")
+	}
+	files := clientFiles{
+		settings: settings,
+		logger:   logging.GetLogger("upstream-tls"),
+	}
+	if err := files.load(); err != nil {
+		return nil, err
+	}
+	files.stamp = files.currentStamp()
+	files.checked = time.Now()
+	if settings.InsecureSkipVerify {
+		files.logger.Warning("upstream TLS certificate verification is disabled (%s)", settings)
+	}
+	return &ClientConfig{settings: settings, files: &files}, nil
+}
+
+// Config returns TLS config for connection to upstream host (host name or IP address, as dialed);
+// upstream certificate is verified for server name override, if set, or for the host
+func (c *ClientConfig) Config(host string) *tls.Config {
+	serverName := c.settings.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	config := tls.Config{
+		ServerName: serverName, // not sent as SNI for IP addresses
+		// verification is done in VerifyConnection, so that CA bundle can be reloaded and
+		// server name verification can be skipped separately
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if c.settings.InsecureSkipVerify {
+				return nil
+			}
+			_, roots := c.files.current()
+			return verify(state, roots, serverName, !c.settings.SkipVerifyHostname)
+		},
+	}
+	if c.settings.CertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, _ := c.files.current()
+			return certificate, nil
+		}
+	}
+	return &config
+}
+
+func verify(state tls.ConnectionState, roots *x509.CertPool, serverName string, verifyHostname bool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("upstream did not present certificate")
+	}
+	options := x509.VerifyOptions{
+		Roots:         roots, // nil - system CAs
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, certificate := range state.PeerCertificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	if verifyHostname {
+		if serverName == "" {
+			return errors.New("upstream server name is unknown")
+		}
+		options.DNSName = serverName // IP addresses are matched against certificate IP SANs
+	}
+	_, err := state.PeerCertificates[0].Verify(options)
+	return err
+}
+
+// region - files
+
+type clientFiles struct {
+	settings    ClientSettings
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	roots       *x509.CertPool
+	stamp       string // files size and modification time
+	checked     time.Time
+	logger      logging.Logger
+}
+
+// current returns client certificate and CA pool, reloading changed files
+func (f *clientFiles) current() (*tls.Certificate, *x509.CertPool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if time.Since(f.checked) >= reloadCheckInterval {
+		f.checked = time.Now()
+		if stamp := f.currentStamp(); stamp != f.stamp {
+			if err := f.load(); err != nil {
+				f.logger.Error("upstream TLS files reload error: %s; keep current files", err)
+			} else {
+				f.stamp = stamp
+				f.logger.Info("upstream TLS files reloaded (%s)", f.settings)
+			}
+		}
+	}
+	return f.certificate, f.roots
+}
+
+func (f *clientFiles) load() error {
+	var roots *x509.CertPool
+	if f.settings.CAFile != "" {
+		data, err := os.ReadFile(f.settings.CAFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", f.settings.CAFile)
+		}
+	}
+	var certificate *tls.Certificate
+	if f.settings.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(f.settings.CertFile, f.settings.KeyFile)
+		if err != nil {
+			return fmt.Errorf("could not load %s: %w", f.settings.CertFile, err)
+		}
+		certificate = &pair
+	}
+	f.roots, f.certificate = roots, certificate
+	return nil
+}
+
+func (f *clientFiles) currentStamp() string {
+	return filesStamp(f.settings.CAFile, f.settings.CertFile, f.settings.KeyFile)
+}
+
+// filesStamp returns files size and modification time (empty paths are skipped)
+func filesStamp(paths ...string) string {
+	var result []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			result = append(result, fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano()))
+		} else {
+			result = append(result, "-")
+		}
+	}
+	return strings.Join(result, ";")
+}
+
+// endregion
@@ -0,0 +1,176 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &testCA{certificate: certificate, key: key}
+}
+
+// issue writes certificate for host names / IP addresses signed by CA to {dir}/{name}.crt and {dir}/{name}.key
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage, hosts ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, ca.certificate, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPem, 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0600))
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	assert.NoError(t, err)
+	return pair
+}
+
+// newClient creates HTTP client making TLS handshakes with upstream config for dialed host (as gateway transport does)
+func newClient(config *ClientConfig) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		DialTLSContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(address)
+			return (&tls.Dialer{Config: config.Config(host)}).DialContext(ctx, network, address)
+		},
+	}}
+}
+
+func newUpstream(t *testing.T, certificate tls.Certificate, clients *x509.CertPool) *httptest.Server {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.TLS = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clients,
+	}
+	upstream.StartTLS()
+	return upstream
+}
+
+func TestClientConfig(t *testing.T) {
+	reloadCheckInterval = 0
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	other := newTestCA(t, dir, "other-ca")
+	ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	clients := x509.NewCertPool()
+	clients.AddCert(ca.certificate)
+	upstream := newUpstream(t, ca.issue(t, dir, "upstream", x509.ExtKeyUsageServerAuth, "upstream.internal", "127.0.0.1"), clients)
+	defer upstream.Close()
+	// certificate is valid for another IP address
+	foreign := newUpstream(t, ca.issue(t, dir, "foreign", x509.ExtKeyUsageServerAuth, "10.9.9.9"), clients)
+	defer foreign.Close()
+
+	get := func(client *http.Client, url string) error {
+		response, err := client.Get(url)
+		if err == nil {
+			_ = response.Body.Close()
+		}
+		return err
+	}
+	call := func(settings ClientSettings) error {
+		config, err := NewClientConfig(settings)
+		if err != nil {
+			return err
+		}
+		return get(newClient(config), upstream.URL)
+	}
+	settings := ClientSettings{
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "client.crt"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		ServerName: "upstream.internal",
+	}
+	assert.NoError(t, call(settings))
+
+	// server name verification
+	mismatch := settings
+	mismatch.ServerName = "other.internal"
+	assert.Error(t, call(mismatch))
+	mismatch.SkipVerifyHostname = true
+	assert.NoError(t, call(mismatch))
+
+	// IP address upstream (no SNI) is verified against certificate IP addresses
+	byAddress := settings
+	byAddress.ServerName = ""
+	assert.NoError(t, call(byAddress))
+	config, err := NewClientConfig(byAddress)
+	assert.NoError(t, err)
+	err = get(newClient(config), foreign.URL)
+	assert.ErrorContains(t, err, "certificate is valid for 10.9.9.9, not 127.0.0.1")
+
+	// unknown CA
+	unknown := settings
+	unknown.CAFile = filepath.Join(dir, "other-ca.crt")
+	assert.Error(t, call(unknown))
+	unknown.InsecureSkipVerify = true
+	assert.NoError(t, call(unknown))
+
+	// client certificate is required by upstream
+	anonymous := settings
+	anonymous.CertFile, anonymous.KeyFile = "", ""
+	assert.Error(t, call(anonymous))
+	anonymous.CertFile = settings.CertFile
+	assert.Error(t, call(anonymous))
+
+	// changed CA bundle is reloaded; broken bundle is ignored
+	config, err = NewClientConfig(settings)
+	assert.NoError(t, err)
+	client := newClient(config)
+	assert.NoError(t, os.WriteFile(settings.CAFile, []byte("broken"), 0600))
+	assert.NoError(t, get(client, upstream.URL))
+	assert.NoError(t, os.WriteFile(settings.CAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.certificate.Raw}), 0600))
+	assert.Error(t, get(client, upstream.URL))
+}
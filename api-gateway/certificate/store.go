@@ -0,0 +1,259 @@
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/slink-go/api-gateway/internal/fswatch"
+	"github.com/slink-go/logging"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Pair is certificate (chain) and private key files pair
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// ParsePairs parses "{cert file}:{key file}" items
+func ParsePairs(items ...string) ([]Pair, error) {
+	var result []Pair
+	for _, item := range items {
+		certFile, keyFile, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("invalid certificate config '%s'", item)
+		}
+		result = append(result, Pair{CertFile: certFile, KeyFile: keyFile})
+	}
+	return result, nil
+}
+
+// Store keeps server certificates, chosen by SNI server name. Certificates are loaded from
+// explicitly configured pairs and from directory ({name}.crt or {name}.pem with {name}.key);
+// on reload certificates are swapped atomically, so established connections are not affected
+type Store struct {
+	dir          string
+	pairs        []Pair
+	certificates atomic.Pointer[certificates]
+	logger       logging.Logger
+}
+
+type certificates struct {
+	byName   map[string]*tls.Certificate // DNS names (incl. wildcards) -> certificate
+	fallback *tls.Certificate            // for clients without SNI or with unknown server name
+	count    int
+}
+
+func NewStore(dir string, pairs ...Pair) (*Store, error) {
+	store := Store{
+		dir:    dir,
+		pairs:  pairs,
+		logger: logging.GetLogger("certificates"),
+	}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// Reload re-reads certificates; on error current certificates are kept
+func (s *Store) Reload() error {
+	pairs, err := s.allPairs()
+	if err != nil {
+		return err
+	}
+	result := certificates{byName: make(map[string]*tls.Certificate)}
+	for _, pair := range pairs {
+		certificate, err := loadPair(pair)
+		if err != nil {
+			return err
+		}
+		if result.fallback == nil {
+			result.fallback = certificate
+		}
+		for _, name := range names(certificate.Leaf) {
+			if _, ok := result.byName[name]; !ok {
+				result.byName[name] = certificate
+			}
+		}
+		result.count++
+	}
+	if result.count == 0 {
+		return errors.New("no certificates found")
+	}
+	s.certificates.Store(&result)
+	s.logger.Info("loaded %d certificate(s)", result.count)
+	return nil
+}
+
+// Watch reloads certificates on certificate directory (and configured pairs directories) changes;
+// if file system notifications are not supported, directories are polled
+func (s *Store) Watch(pollInterval time.Duration) {
+	var dirs []string
+	if s.dir != "" {
+		dirs = append(dirs, s.dir)
+	}
+	for _, pair := range s.pairs {
+		dirs = append(dirs, filepath.Dir(pair.CertFile), filepath.Dir(pair.KeyFile))
+	}
+	slices.Sort(dirs)
+	reload := func() {
+		if err := s.Reload(); err != nil {
+			s.logger.Error("certificates reload error: %s; keep current certificates", err)
+		}
+	}
+	if err := fswatch.WatchDirs(slices.Compact(dirs), s.logger, reload); err != nil {
+		s.logger.Warning("could not watch certificates (%s); fall back to polling every %s", err, pollInterval)
+		go s.poll(pollInterval, reload)
+	}
+}
+
+// poll calls reload when certificate files are added, removed or changed (size or modification time)
+func (s *Store) poll(interval time.Duration, reload func()) {
+	stamp := s.stamp()
+	for range time.Tick(interval) {
+		if current := s.stamp(); current != stamp {
+			stamp = current
+			reload()
+		}
+	}
+}
+
+// stamp returns certificate files state
+func (s *Store) stamp() string {
+	pairs, err := s.allPairs()
+	if err != nil {
+		return ""
+	}
+	var paths []string
+	for _, pair := range pairs {
+		paths = append(paths, pair.CertFile, pair.KeyFile)
+	}
+	return strings.Join(paths, ";") + "|" + filesStamp(paths...)
+}
+
+// allPairs returns configured pairs and pairs found in certificate directory
+func (s *Store) allPairs() ([]Pair, error) {
+	pairs := slices.Clone(s.pairs)
+	if s.dir != "" {
+		found, err := dirPairs(s.dir)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, found...)
+	}
+	return pairs, nil
+}
+
+// GetCertificate returns certificate for TLS handshake (see tls.Config)
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	current := s.certificates.Load()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if certificate, ok := current.byName[name]; ok {
+		return certificate, nil
+	}
+	if _, domain, ok := strings.Cut(name, "."); ok {
+		if certificate, ok := current.byName["*."+domain]; ok {
+			return certificate, nil
+		}
+	}
+	return current.fallback, nil
+}
+
+// TLSConfig creates server TLS config using store certificates
+func (s *Store) TLSConfig(minVersion uint16, cipherSuites []uint16) *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites, // TLS 1.3 cipher suites are not configurable
+	}
+}
+
+// ParseVersion parses TLS version ("1.2", "1.3")
+func ParseVersion(value string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "TLS") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2", "":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version '%s'", value)
+	}
+}
+
+// ParseCipherSuites parses cipher suite names (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256);
+// insecure cipher suites are rejected
+func ParseCipherSuites(names ...string) ([]uint16, error) {
+	var result []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		index := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if index < 0 {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		result = append(result, tls.CipherSuites()[index].ID)
+	}
+	return result, nil
+}
+
+// dirPairs finds certificate / key pairs in directory (in file names order)
+func dirPairs(dir string) ([]Pair, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []Pair
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if strings.HasPrefix(name, ".") || (ext != ".crt" && ext != ".pem") {
+			// hidden files (incl. kubernetes secret "..data" links) are skipped
+			continue
+		}
+		keyFile := filepath.Join(dir, strings.TrimSuffix(name, ext)+".key")
+		if _, err := os.Stat(keyFile); err != nil {
+			continue
+		}
+		result = append(result, Pair{CertFile: filepath.Join(dir, name), KeyFile: keyFile})
+	}
+	return result, nil
+}
+
+func loadPair(pair Pair) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", pair.CertFile, err)
+	}
+	if certificate.Leaf == nil {
+		if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", pair.CertFile, err)
+		}
+	}
+	return &certificate, nil
+}
+
+func names(leaf *x509.Certificate) []string {
+	var result []string
+	for _, name := range leaf.DNSNames {
+		result = append(result, strings.ToLower(name))
+	}
+	if len(result) == 0 && leaf.Subject.CommonName != "" {
+		result = append(result, strings.ToLower(leaf.Subject.CommonName))
+	}
+	for _, ip := range leaf.IPAddresses {
+		result = append(result, ip.String())
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes self-signed certificate for DNS names to {dir}/{name}.crt and {dir}/{name}.key
+func writeCertificate(t *testing.T, dir, name string, dnsNames ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func served(t *testing.T, store *Store, serverName string) string {
+	certificate, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	assert.NoError(t, err)
+	return certificate.Leaf.Subject.CommonName
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewStore(dir)
+	assert.Error(t, err)
+
+	writeCertificate(t, dir, "a", "a.example.com")
+	writeCertificate(t, dir, "wildcard", "*.example.com")
+	writeCertificate(t, dir, "b", "b.example.org", "B.example.net")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "orphan.crt"), []byte("no key"), 0600))
+
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", served(t, store, "a.example.com"))
+	assert.Equal(t, "a", served(t, store, "A.Example.Com."))
+	assert.Equal(t, "wildcard", served(t, store, "c.example.com"))
+	assert.Equal(t, "b", served(t, store, "b.example.net"))
+	assert.Equal(t, "a", served(t, store, ""))                // first certificate
+	assert.Equal(t, "a", served(t, store, "x.y.example.com")) // wildcard matches single label only
+
+	// broken certificate is rejected, current certificates are kept
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.crt"), []byte("broken"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.key"), []byte("broken"), 0600))
+	assert.Error(t, store.Reload())
+	assert.Equal(t, "b", served(t, store, "b.example.org"))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "broken.crt")))
+
+	// certificates are reloaded on directory change
+	store.Watch(time.Millisecond * 50)
+	writeCertificate(t, dir, "c", "c.example.com")
+	assert.Eventually(t, func() bool {
+		return served(t, store, "c.example.com") == "c"
+	}, time.Second*2, time.Millisecond*20)
+}
+
+func TestStorePairs(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "a", "a.example.com")
+	pairs, err := ParsePairs(filepath.Join(dir, "a.crt") + ":" + filepath.Join(dir, "a.key"))
+	assert.NoError(t, err)
+	store, err := NewStore("", pairs...)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", served(t, store, "a.example.com"))
+
+	_, err = ParsePairs("a.crt")
+	assert.Error(t, err)
+	_, err = NewStore("", Pair{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: filepath.Join(dir, "a.key")})
+	assert.Error(t, err)
+}
+
+func TestParseTLSSettings(t *testing.T) {
+	version, err := ParseVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+	version, err = ParseVersion("TLS1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+	_, err = ParseVersion("2.0")
+	assert.Error(t, err)
+
+	suites, err := ParseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, suites)
+	_, err = ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA")
+	assert.Error(t, err)
+}
+
+func TestStorePoll(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "a", "a.example.com")
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	var reloads atomic.Int32
+	go store.poll(time.Millisecond*10, func() {
+		reloads.Add(1)
+	})
+	// unchanged files are not reloaded
+	time.Sleep(time.Millisecond * 100)
+	assert.Zero(t, reloads.Load())
+
+	writeCertificate(t, dir, "b", "b.example.com")
+	assert.Eventually(t, func() bool {
+		return reloads.Load() > 0
+	}, time.Second, time.Millisecond*10)
+	count := reloads.Load()
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, count, reloads.Load())
+}
@@ -1,8 +1,10 @@
 package templates
 
 import (
-	"github.com/slink-go/api-gateway/discovery"
+	"fmt"
+	"github.com/slink-go/api-gateway/registry"
 	"slices"
+	"strings"
 )
 
 var colorIndex = 0
@@ -27,13 +29,13 @@ func getColor() string {
 	return color
 }
 
-func Cards(remotes []discovery.Remote) []Card {
+func Cards(remotes []registry.InstanceStatus) []Card {
 	var result []Card
 
-	services := make(map[string][]discovery.Remote)
+	services := make(map[string][]registry.InstanceStatus)
 	for _, r := range remotes {
 		if _, ok := services[r.App]; !ok {
-			services[r.App] = []discovery.Remote{}
+			services[r.App] = []registry.InstanceStatus{}
 		}
 		services[r.App] = append(services[r.App], r)
 	}
@@ -45,7 +47,7 @@ func Cards(remotes []discovery.Remote) []Card {
 	for _, k := range keys {
 		instances := make([]string, 0)
 		for _, instance := range services[k] {
-			instances = append(instances, instance.String())
+			instances = append(instances, describe(instance))
 		}
 		result = append(result, Card{
 			Title:     k,
@@ -55,3 +57,26 @@ func Cards(remotes []discovery.Remote) []Card {
 	}
 	return result
 }
+
+func describe(r registry.InstanceStatus) string {
+	var details []string
+	if r.Health != "" && r.Health != registry.HealthUnknown {
+		details = append(details, strings.ToLower(r.Health))
+	}
+	if r.Ejected {
+		details = append(details, "ejected")
+	}
+	if r.Zone != "" {
+		details = append(details, "zone: "+r.Zone)
+	}
+	if r.Weight > 0 {
+		details = append(details, fmt.Sprintf("weight: %d", r.Weight))
+	}
+	if r.Version != "" {
+		details = append(details, "version: "+r.Version)
+	}
+	if len(details) == 0 {
+		return r.String()
+	}
+	return fmt.Sprintf("%s (%s)", r.String(), strings.Join(details, ", "))
+}
@@ -7,10 +7,31 @@ const (
 	ServicePort       = "SERVICE_PORT" // service port ( + port for registration in eureka)
 	MonitoringEnabled = "MONITORING_ENABLED"
 	MonitoringPort    = "MONITORING_PORT"
+	MonitoringTls     = "MONITORING_TLS" // serve monitoring with proxy TLS config
 
-	TargetConnTimeout         = "TARGET_CONN_TIMEOUT"
-	TargetConnKeepAlive       = "TARGET_CONN_KEEPALIVE"
-	TargetTLSHandshakeTimeout = "TARGET_TLS_HANDSHAKE_TIMEOUT"
+	TlsEnabled            = "TLS_ENABLED"
+	TlsCertificates       = "TLS_CERTIFICATES"       // comma-separated "{cert file}:{key file}" list
+	TlsCertDir            = "TLS_CERT_DIR"           // directory with {name}.crt (or .pem) and {name}.key files
+	TlsCertPollInterval   = "TLS_CERT_POLL_INTERVAL" // if directory can not be watched; default 30s
+	TlsMinVersion         = "TLS_MIN_VERSION"        // default 1.2
+	TlsCipherSuites       = "TLS_CIPHER_SUITES"      // comma-separated list, default - Go defaults
+	TlsRedirectPort       = "TLS_REDIRECT_PORT"      // plain HTTP port redirecting to HTTPS
+	HstsMaxAge            = "HSTS_MAX_AGE"           // seconds, default 5184000; 0 - disabled
+	HstsIncludeSubdomains = "HSTS_INCLUDE_SUBDOMAINS"
+
+	TargetConnTimeout           = "TARGET_CONN_TIMEOUT"
+	TargetConnKeepAlive         = "TARGET_CONN_KEEPALIVE"
+	TargetTLSHandshakeTimeout   = "TARGET_TLS_HANDSHAKE_TIMEOUT"
+	TargetMaxIdleConnsPerHost   = "TARGET_MAX_IDLE_CONNS_PER_HOST"
+	TargetMaxConnsPerHost       = "TARGET_MAX_CONNS_PER_HOST"
+	TargetIdleConnTimeout       = "TARGET_IDLE_CONN_TIMEOUT"
+	TargetResponseHeaderTimeout = "TARGET_RESPONSE_HEADER_TIMEOUT"
+	TargetTLSCAFile             = "TARGET_TLS_CA_FILE"   // CA bundle for upstream certificates; default - system CAs
+	TargetTLSCertFile           = "TARGET_TLS_CERT_FILE" // client certificate for mTLS
+	TargetTLSKeyFile            = "TARGET_TLS_KEY_FILE"
+	TargetTLSServerName         = "TARGET_TLS_SERVER_NAME"     // SNI override
+	TargetTLSVerifyHostname     = "TARGET_TLS_VERIFY_HOSTNAME" // default true
+	TargetTLSInsecureSkipVerify = "TARGET_TLS_INSECURE_SKIP_VERIFY"
 
 	AuthEnabled                 = "AUTH_ENABLED"
 	AuthEndpoint                = "AUTH_ENDPOINT"
@@ -19,6 +40,14 @@ const (
 	AuthSkip                    = "AUTH_SKIP"
 	AuthCacheTTL                = "AUTH_CACHE_TTL"
 
+	ClientIpSource         = "CLIENT_IP_SOURCE"          // xff, x-real-ip, forwarded or remote; default xff
+	ClientIpTrustedProxies = "CLIENT_IP_TRUSTED_PROXIES" // comma-separated CIDRs (or addresses) list
+	ClientIpTrustedHops    = "CLIENT_IP_TRUSTED_HOPS"    // default 0
+
+	ForwardedMode         = "FORWARDED_MODE"          // append, overwrite or strip; default append
+	ForwardedRfc7239      = "FORWARDED_RFC7239"       // add RFC 7239 Forwarded header; default false
+	ForwardedPreserveHost = "FORWARDED_PRESERVE_HOST" // comma-separated list of services which receive original Host header
+
 	RequestTimeout = "REQUEST_TIMEOUT"
 	TimeoutSkip    = "TIMEOUT_SKIP"
 
@@ -35,11 +64,89 @@ const (
 	DiscoPassword            = "DISCO_PASSWORD"
 	DiscoClientRetryInterval = "DISCO_CLIENT_RETRY_INTERVAL"
 
-	StaticRegistryFile = "STATIC_REGISTRY_FILE"
+	K8sClientEnabled = "K8S_CLIENT_ENABLED"
+	K8sUrl           = "K8S_URL"        // default: in-cluster API server address
+	K8sToken         = "K8S_TOKEN"      //
+	K8sTokenFile     = "K8S_TOKEN_FILE" // default: service account token
+	K8sCAFile        = "K8S_CA_FILE"    // default: service account CA bundle
+	K8sInsecure      = "K8S_INSECURE"
+	K8sNamespace     = "K8S_NAMESPACE" // default: service account namespace
+	K8sLabelSelector = "K8S_LABEL_SELECTOR"
+	K8sPortName      = "K8S_PORT_NAME"
+	K8sRetryInterval = "K8S_RETRY_INTERVAL"
+
+	ConsulClientEnabled = "CONSUL_CLIENT_ENABLED"
+	ConsulUrl           = "CONSUL_URL"
+	ConsulToken         = "CONSUL_TOKEN"
+	ConsulDatacenter    = "CONSUL_DATACENTER"
+	ConsulTag           = "CONSUL_TAG"
+	ConsulWaitTime      = "CONSUL_WAIT_TIME" // default 5m
+	ConsulRetryInterval = "CONSUL_RETRY_INTERVAL"
+
+	DnsClientEnabled = "DNS_CLIENT_ENABLED"
+	DnsServices      = "DNS_SERVICES" // comma-separated "{service}={query}" list
+	DnsServers       = "DNS_SERVERS"  // default: nameservers from /etc/resolv.conf
+	DnsTimeout       = "DNS_TIMEOUT"
+	DnsMinTTL        = "DNS_MIN_TTL" // default 5s
+	DnsMaxTTL        = "DNS_MAX_TTL" // default 5m
+	DnsRetryInterval = "DNS_RETRY_INTERVAL"
+
+	StaticRegistryFile         = "STATIC_REGISTRY_FILE"
+	StaticRegistryPollInterval = "STATIC_REGISTRY_POLL_INTERVAL" // used if file system notifications are not available
+
+	PathPrefixes     = "PATH_PREFIXES"      // comma-separated "{segment}[:{move|keep|strip}]" list, default "api"
+	PathPreserveCase = "PATH_PRESERVE_CASE" // keep case of path segments (default false - path is lower-cased)
+	PathStrict       = "PATH_STRICT"        // reject ambiguous paths
+
+	RoutesFile           = "ROUTES_FILE"             // declarative routes (YAML or JSON)
+	VirtualHosts         = "VIRTUAL_HOSTS"           // comma-separated "{host pattern}={service}" list
+	TrafficSplitFile     = "TRAFFIC_SPLIT_FILE"      // weighted traffic splits (YAML or JSON)
+	TrafficSplitApiToken = "TRAFFIC_SPLIT_API_TOKEN" // bearer token for split weights changes; not set - splits are read-only
+	FallbackFile         = "FALLBACK_FILE"           // default / service fallbacks (YAML or JSON)
 
 	RegistryRefreshInitialDelay = "REGISTRY_REFRESH_INITIAL_DELAY"
 	RegistryRefreshInterval     = "REGISTRY_REFRESH_INTERVAL" // default 60s
 
+	LoadBalancingStrategy       = "LB_STRATEGY"        // default round-robin
+	LoadBalancingStrategyCustom = "LB_STRATEGY_CUSTOM" // comma-separated "{service}:{strategy}" list
+	LoadBalancingHashKey        = "LB_HASH_KEY"        // "header:{name}", "cookie:{name}", "ip" or "user:{field}"
+	LoadBalancingAffinityCookie = "LB_AFFINITY_COOKIE" // affinity cookie name (sticky sessions are disabled if not set)
+
+	HealthCheckEnabled            = "HEALTH_CHECK_ENABLED"
+	HealthCheckType               = "HEALTH_CHECK_TYPE"   // http (default) or tcp
+	HealthCheckPath               = "HEALTH_CHECK_PATH"   // default "/"
+	HealthCheckStatus             = "HEALTH_CHECK_STATUS" // expected status codes, default "200-399"
+	HealthCheckInterval           = "HEALTH_CHECK_INTERVAL"
+	HealthCheckTimeout            = "HEALTH_CHECK_TIMEOUT"
+	HealthCheckHealthyThreshold   = "HEALTH_CHECK_HEALTHY_THRESHOLD"
+	HealthCheckUnhealthyThreshold = "HEALTH_CHECK_UNHEALTHY_THRESHOLD"
+	HealthCheckCustom             = "HEALTH_CHECK_CUSTOM" // comma-separated "{service}:{type}[:{path}]" list
+
+	OutlierDetectionEnabled   = "OUTLIER_DETECTION_ENABLED"
+	OutlierConsecutiveErrors  = "OUTLIER_CONSECUTIVE_ERRORS"   // default 5
+	OutlierBaseEjectionTime   = "OUTLIER_BASE_EJECTION_TIME"   // default 30s
+	OutlierMaxEjectionTime    = "OUTLIER_MAX_EJECTION_TIME"    // default 5m
+	OutlierMaxEjectionPercent = "OUTLIER_MAX_EJECTION_PERCENT" // default 50
+
+	RetryEnabled            = "RETRY_ENABLED"
+	RetryMaxAttempts        = "RETRY_MAX_ATTEMPTS"    // default 3 (including initial request)
+	RetryPerTryTimeout      = "RETRY_PER_TRY_TIMEOUT" // default 0 (no limit)
+	RetryBackoffBase        = "RETRY_BACKOFF_BASE"    // default 25ms
+	RetryBackoffMax         = "RETRY_BACKOFF_MAX"     // default 250ms
+	RetryOnStatus           = "RETRY_ON_STATUS"       // default "502,503,504"
+	RetryNonIdempotent      = "RETRY_NON_IDEMPOTENT"  // comma-separated list of services which allow non-idempotent requests retry
+	RetryBudgetRatio        = "RETRY_BUDGET_RATIO"    // default 0.2
+	RetryBudgetMinPerSecond = "RETRY_BUDGET_MIN_PER_SECOND"
+
+	MirrorCustom         = "MIRROR_CUSTOM"  // comma-separated "{service}:{shadow service}[:{percent}]" list
+	MirrorPercent        = "MIRROR_PERCENT" // default 100
+	MirrorTimeout        = "MIRROR_TIMEOUT" // default 5s
+	MirrorMaxBodySize    = "MIRROR_MAX_BODY_SIZE"
+	MirrorMaxConcurrency = "MIRROR_MAX_CONCURRENCY"
+
+	UpstreamErrorBody       = "UPSTREAM_ERROR_BODY"        // keep, replace or wrap upstream 5xx response body; default replace
+	UpstreamErrorBodyCustom = "UPSTREAM_ERROR_BODY_CUSTOM" // comma-separated "{service}:{mode}" list
+
 	LimiterLimit                  = "LIMITER_LIMIT"
 	LimiterPeriod                 = "LIMITER_PERIOD"
 	LimiterMode                   = "LIMITER_MODE"
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/middleware/security"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/logging"
+	"net/http"
+	"strings"
+)
+
+// affinity builds load balancing hints for the request: hash key for consistent hash
+// strategy and pinned instance from gateway-issued affinity cookie
+type affinity struct {
+	keySource string // header, cookie, ip, user
+	keyName   string
+	cookie    string // affinity cookie name prefix (empty - sticky sessions are disabled)
+}
+
+// newAffinity parses hash key source config: "header:{name}", "cookie:{name}", "ip" or "user:{field}"
+func newAffinity(keySource, cookie string) *affinity {
+	result := affinity{
+		cookie: strings.TrimSpace(cookie),
+	}
+	if keySource == "" {
+		return &result
+	}
+	parts := strings.SplitN(strings.TrimSpace(keySource), ":", 2)
+	source := strings.ToLower(parts[0])
+	switch {
+	case source == "ip":
+		result.keySource = source
+	case (source == "header" || source == "cookie" || source == "user") && len(parts) == 2 && parts[1] != "":
+		result.keySource = source
+		result.keyName = parts[1]
+	default:
+		logging.GetLogger("affinity").Warning("invalid hash key source '%s'; hash key is not used", keySource)
+	}
+	return &result
+}
+
+func (a *affinity) hint(ctx *gin.Context, service string) registry.Hint {
+	if a == nil {
+		return registry.Hint{}
+	}
+	var hint registry.Hint
+	switch a.keySource {
+	case "header":
+		hint.HashKey = ctx.GetHeader(a.keyName)
+	case "cookie":
+		hint.HashKey, _ = ctx.Cookie(a.keyName)
+	case "ip":
+		hint.HashKey = clientIp(ctx)
+	case "user":
+		if v, ok := ctx.Get(constants.RequestContextUserDetails); ok {
+			if userDetails, ok := v.(security.UserDetails); ok {
+				hint.HashKey = userDetails[a.keyName]
+			}
+		}
+	}
+	if a.cookie != "" {
+		hint.Instance, _ = ctx.Cookie(a.cookieName(service))
+	}
+	return hint
+}
+
+// userKey checks if hash key is taken from user details (known after authentication only)
+func (a *affinity) userKey() bool {
+	return a != nil && a.keySource == "user"
+}
+
+// pin issues affinity cookie for the chosen instance (if it differs from the one requested)
+func (a *affinity) pin(ctx *gin.Context, service string, hint registry.Hint, instance *registry.Instance) {
+	if a == nil || a.cookie == "" || instance == nil || hint.Instance == instance.Id() {
+		return
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(a.cookieName(service), instance.Id(), 0, "/", "", ctx.Request.TLS != nil, true)
+}
+
+func (a *affinity) cookieName(service string) string {
+	return a.cookie + "-" + strings.ToLower(service)
+}
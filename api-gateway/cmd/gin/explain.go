@@ -0,0 +1,156 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/middleware/rate"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/util/env"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// explanation describes how gateway would handle the request (see explain handler)
+type explanation struct {
+	Method     string               `json:"method"`
+	Path       string               `json:"path"`
+	Host       string               `json:"host,omitempty"`
+	Via        string               `json:"via,omitempty"`   // route, virtual-host, convention or fallback
+	Route      string               `json:"route,omitempty"` // matched route id
+	Service    string               `json:"service,omitempty"`
+	Target     string               `json:"target,omitempty"`
+	TargetPath string               `json:"targetPath,omitempty"` // rewritten upstream path
+	Headers    http.Header          `json:"headers,omitempty"`    // headers added by route filters
+	Status     int                  `json:"status,omitempty"`     // response status override / static fallback response status
+	Mirror     *resolver.Mirror     `json:"mirror,omitempty"`
+	Selected   string               `json:"selected,omitempty"` // instance picked by load balancer
+	Instances  []explainedInstance  `json:"instances,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	Middleware explainedMiddlewares `json:"middleware"`
+}
+
+type explainedInstance struct {
+	registry.InstanceStatus
+	Selected bool `json:"selected,omitempty"`
+}
+
+type explainedMiddlewares struct {
+	AuthEnabled bool                `json:"authEnabled"`
+	AuthSkip    bool                `json:"authSkip"`
+	Timeout     string              `json:"timeout,omitempty"` // empty if request is skipped by timeout middleware
+	TimeoutSkip bool                `json:"timeoutSkip"`
+	RateLimit   *explainedRateLimit `json:"rateLimit,omitempty"`
+}
+
+type explainedRateLimit struct {
+	Mode   string `json:"mode"`
+	Bucket string `json:"bucket"` // custom limit pattern or "default"
+	Limit  int64  `json:"limit"`
+	Period string `json:"period"`
+}
+
+// explain runs request resolution without proxying the request:
+// GET /explain?method=GET&path=/api/service-a/items&host=a.example.com&header=X-Canary:true
+func (g *GinBasedGateway) explain(ctx *gin.Context) {
+	path := ctx.Query("path")
+	if !strings.HasPrefix(path, "/") {
+		ctx.String(http.StatusBadRequest, "path parameter should start with '/'\n")
+		return
+	}
+	request, err := http.NewRequest(strings.ToUpper(ctx.DefaultQuery("method", http.MethodGet)), path, nil)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "%s\n", err)
+		return
+	}
+	request.Host = ctx.Query("host")
+	for _, header := range ctx.QueryArray("header") {
+		name, value, _ := strings.Cut(header, ":")
+		request.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	result := explanation{
+		Method:     request.Method,
+		Path:       request.URL.EscapedPath(),
+		Host:       request.Host,
+		Middleware: g.explainMiddlewares(request),
+	}
+	if g.reverseProxy == nil {
+		ctx.IndentedJSON(http.StatusOK, result)
+		return
+	}
+	// hints are built as for proxied request (affinity cookie, hash key), but selection is not recorded
+	hctx := ctx.Copy()
+	hctx.Request = request
+	target, err := g.reverseProxy.ResolveTarget(request, func(service string) registry.Hint {
+		hint := g.affinity.hint(hctx, service)
+		hint.DryRun = true
+		return hint
+	})
+	if err != nil {
+		result.Error = err.Error()
+		ctx.IndentedJSON(http.StatusOK, result)
+		return
+	}
+	result.Via = target.Via
+	result.Route = target.Route
+	result.Service = target.Service
+	result.Target = target.Url
+	result.Headers = target.Headers
+	result.Status = target.Status
+	result.Mirror = target.Mirror
+	if target.Response != nil {
+		result.Status = target.Response.Status
+	}
+	if u, err := url.Parse(target.Url); err == nil && target.Url != "" {
+		result.TargetPath = u.EscapedPath()
+	}
+	if target.Instance != nil {
+		result.Selected = target.Instance.String()
+		result.Instances = g.explainInstances(target.Instance)
+	}
+	ctx.IndentedJSON(http.StatusOK, result)
+}
+
+// explainInstances returns instances of the selected instance service
+func (g *GinBasedGateway) explainInstances(selected *registry.Instance) []explainedInstance {
+	if g.registry == nil {
+		return nil
+	}
+	var result []explainedInstance
+	for _, status := range g.registry.List() {
+		if !strings.EqualFold(status.App, selected.App) {
+			continue
+		}
+		result = append(result, explainedInstance{
+			InstanceStatus: status,
+			Selected:       status.Compare(selected.Remote) == 0,
+		})
+	}
+	return result
+}
+
+func (g *GinBasedGateway) explainMiddlewares(request *http.Request) explainedMiddlewares {
+	result := explainedMiddlewares{
+		AuthEnabled: env.BoolOrDefault(variables.AuthEnabled, false),
+		AuthSkip:    authSkipMatcher != nil && authSkipMatcher.Matches(request.URL.Path),
+		TimeoutSkip: timeoutSkipMatcher == nil || timeoutSkipMatcher.Matches(request.URL.Path),
+	}
+	if !result.TimeoutSkip {
+		result.Timeout = env.DurationOrDefault(variables.RequestTimeout, 5*time.Minute).String()
+	}
+	if g.limiter != nil && g.limiter.Mode() != rate.LimiterModeOff {
+		rateLimit := explainedRateLimit{
+			Mode:   g.limiter.Mode().String(),
+			Bucket: g.limiter.KeyForPath(request.URL.Path),
+		}
+		if lm := g.limiter.Get(request.URL.Path); lm != nil {
+			rateLimit.Limit = lm.Rate.Limit
+			rateLimit.Period = lm.Rate.Period.String()
+		}
+		result.RateLimit = &rateLimit
+	}
+	return result
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
-	helmet "github.com/danielkov/gin-helmet"
 	"github.com/gin-gonic/gin"
 	"github.com/slink-go/api-gateway/cmd/common/templates"
 	"github.com/slink-go/api-gateway/cmd/common/variables"
 	"github.com/slink-go/api-gateway/gateway"
 	"github.com/slink-go/api-gateway/middleware/auth"
+	"github.com/slink-go/api-gateway/middleware/client"
 	"github.com/slink-go/api-gateway/middleware/constants"
 	"github.com/slink-go/api-gateway/middleware/rate"
 	"github.com/slink-go/api-gateway/middleware/security"
 	"github.com/slink-go/api-gateway/proxy"
 	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
 	"github.com/slink-go/logging"
 	"github.com/slink-go/util/env"
 	"net/http"
@@ -27,7 +30,11 @@ type GinBasedGateway struct {
 	authCache           auth.Cache
 	reverseProxy        *proxy.ReverseProxy
 	registry            registry.ServiceRegistry
+	trafficSplitter     *resolver.TrafficSplitter
 	limiter             rate.Limiter
+	clientAddress       *client.AddressResolver
+	tlsConfig           *tls.Config
+	affinity            *affinity
 	quitChn             chan struct{}
 }
 
@@ -100,6 +107,38 @@ func WithReverseProxy(value *proxy.ReverseProxy) Option {
 	return &reverseProxyOption{value}
 }
 
+// endregion
+// region -> client address resolver
+
+type clientAddressOption struct {
+	value *client.AddressResolver
+}
+
+func (o *clientAddressOption) apply(g *GinBasedGateway) {
+	if o.value != nil {
+		g.clientAddress = o.value
+	}
+}
+func WithClientAddressResolver(value *client.AddressResolver) Option {
+	return &clientAddressOption{value}
+}
+
+// endregion
+// region -> TLS config
+
+type tlsConfigOption struct {
+	value *tls.Config
+}
+
+func (o *tlsConfigOption) apply(g *GinBasedGateway) {
+	if o.value != nil {
+		g.tlsConfig = o.value
+	}
+}
+func WithTLSConfig(value *tls.Config) Option {
+	return &tlsConfigOption{value}
+}
+
 // endregion
 // region -> rate limiter
 
@@ -132,6 +171,22 @@ func WithRegistry(value registry.ServiceRegistry) Option {
 	return &registryOption{value}
 }
 
+// endregion
+// region -> traffic splitter
+
+type trafficSplitterOption struct {
+	value *resolver.TrafficSplitter
+}
+
+func (o *trafficSplitterOption) apply(g *GinBasedGateway) {
+	if o.value != nil {
+		g.trafficSplitter = o.value
+	}
+}
+func WithTrafficSplitter(value *resolver.TrafficSplitter) Option {
+	return &trafficSplitterOption{value}
+}
+
 // endregion
 // region -> quit chn
 
@@ -155,7 +210,8 @@ func WithQuitChn(value chan struct{}) Option {
 
 func NewGinBasedGateway(options ...Option) gateway.Gateway {
 	gw := GinBasedGateway{
-		logger: logging.GetLogger("gin-gateway"),
+		logger:        logging.GetLogger("gin-gateway"),
+		clientAddress: client.NewAddressResolver(),
 	}
 	for _, option := range options {
 		if option != nil {
@@ -171,12 +227,24 @@ func (g *GinBasedGateway) Serve(addresses ...string) {
 		panic("service address(es) not set")
 	}
 
+	g.affinity = newAffinity(
+		env.StringOrDefault(variables.LoadBalancingHashKey, ""),
+		env.StringOrDefault(variables.LoadBalancingAffinityCookie, ""),
+	)
 	if env.BoolOrDefault(variables.MonitoringEnabled, false) {
 		if len(addresses) > 1 && addresses[1] != "" {
+			var monitoringTls *tls.Config
+			if env.BoolOrDefault(variables.MonitoringTls, false) {
+				monitoringTls = g.tlsConfig
+			}
 			go NewService("monitor").
+				WithTLS(monitoringTls).
 				//WithHandler("/monitor", monitor.New(monitor.Config{Title: "VOID API Gateway (monitoring)"})) // TODO: fiber-like monitoring
 				WithGetHandlers("/", g.monitoringPage).
 				WithGetHandlers("/list", g.listRemotes).
+				WithGetHandlers("/splits", g.listSplits).
+				WithPutHandlers("/splits/:service", apiToken(env.StringOrDefault(variables.TrafficSplitApiToken, "")), g.updateSplit).
+				WithGetHandlers("/explain", g.explain).
 				WithStatic("/s", "./static").
 				Run(addresses[1])
 		} else {
@@ -185,24 +253,34 @@ func (g *GinBasedGateway) Serve(addresses ...string) {
 	}
 	if addresses[0] != "" {
 		authEnabled := env.BoolOrDefault(variables.AuthEnabled, false)
+		// with user details hash key instance is selected after authentication; target is still resolved
+		// before it (dry run), so unresolvable requests are rejected regardless of authentication
+		userKey := authEnabled && g.affinity.userKey()
 		NewService("proxy").
 			WithPrometheus().
 			WithMiddleware(gin.Recovery()).
+			WithMiddleware(requestId()).
+			WithMiddleware(clientAddress(g.clientAddress)).
 			WithMiddleware(timeouter(env.DurationOrDefault(variables.RequestTimeout, 5*time.Minute), timeoutSkipMatcher)).
 			WithMiddleware(customLogger()).
 			WithMiddleware(headersCleaner()).
 			WithMiddleware(rateLimiter(g.limiter)).
-			WithMiddleware(helmet.Default()). // TODO: custom helmet config
+			WithMiddleware(securityHeaders(
+				env.Int64OrDefault(variables.HstsMaxAge, 5184000),
+				env.BoolOrDefault(variables.HstsIncludeSubdomains, true),
+			)...).
 			//WithMiddleware(csrf.New()). // TODO: implement it for Gin (?)
-			WithMiddleware(proxyTargetResolver(g.reverseProxy)).
-			//WithMiddleware(circuitBreaker()).
+			WithMiddleware(proxyTargetResolver(g.reverseProxy, g.affinity, userKey)).
 			WithOptionalMiddleware(authEnabled, authResolver(g.authProvider)).
 			WithOptionalMiddleware(authEnabled, authCache(g.authCache)).
 			WithOptionalMiddleware(authEnabled, authProvider(g.userDetailsProvider, g.authCache)).
 			WithMiddleware(localeResolver()).
 			WithMiddleware(contextConfigurator()).
+			WithOptionalMiddleware(userKey, proxyTargetResolver(g.reverseProxy, g.affinity, false)).
 			WithNoRouteHandlers(g.proxyHandler).
 			WithQuitChn(g.quitChn).
+			WithTLS(g.tlsConfig).
+			WithHttpsRedirect(g.redirectAddress()).
 			Run(addresses[0])
 
 	} else {
@@ -210,6 +288,13 @@ func (g *GinBasedGateway) Serve(addresses ...string) {
 	}
 }
 
+func (g *GinBasedGateway) redirectAddress() string {
+	if port := env.Int64OrDefault(variables.TlsRedirectPort, 0); port > 0 {
+		return fmt.Sprintf(":%d", port)
+	}
+	return ""
+}
+
 // endregion
 // region - monitoring
 
@@ -233,6 +318,38 @@ func (g *GinBasedGateway) listRemotes(ctx *gin.Context) {
 	}
 }
 
+func (g *GinBasedGateway) listSplits(ctx *gin.Context) {
+	if g.trafficSplitter == nil {
+		ctx.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, g.trafficSplitter.Splits())
+}
+
+// updateSplit changes traffic split backend weights at runtime; request body: {"{backend}": {weight}, ...}
+func (g *GinBasedGateway) updateSplit(ctx *gin.Context) {
+	if g.trafficSplitter == nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	var weights map[string]int
+	if err := ctx.ShouldBindJSON(&weights); err != nil {
+		ctx.String(http.StatusBadRequest, "%s\n", err)
+		return
+	}
+	split, err := g.trafficSplitter.SetWeights(ctx.Param("service"), weights)
+	if errors.Is(err, resolver.NewErrUnknownTrafficSplit("")) {
+		ctx.String(http.StatusNotFound, "%s\n", err)
+		return
+	}
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "%s\n", err)
+		return
+	}
+	g.logger.Info("traffic split %s weights changed: %v", split.Service, weights)
+	ctx.IndentedJSON(http.StatusOK, split)
+}
+
 // endregion
 // region - proxy
 
@@ -240,14 +357,23 @@ func (g *GinBasedGateway) proxyHandler(ctx *gin.Context) {
 
 	proxyTarget, statusCode, err := g.getProxyTarget(ctx)
 	if err != nil {
-		ctx.AbortWithError(statusCode, err)
+		g.logger.Warning("%s %s: %s (request id: %s)", ctx.Request.Method, ctx.Request.URL, err, ctx.GetString(constants.CtxRequestId))
+		_ = ctx.Error(err)
+		proxy.WriteProblem(ctx.Writer, ctx.Request, proxy.NewProblem(ctx.Request, statusCode, "proxy target is not resolved"))
+		ctx.Abort()
+		return
 	}
 
 	g.logger.Trace("proxying %s", proxyTarget)
 
-	//ctx.Set("X-Forwarded-For", ctx.RemoteIP())
-	//ctx.Set("X-Real-Ip", ctx.ClientIP())
+	// report in-flight requests to registry (used by least-request load balancing strategies);
+	// upstream call results are reported by reverse proxy (used by outlier detection)
+	if instance := g.getProxyInstance(ctx); instance != nil {
+		instance.Begin()
+		defer instance.End()
+	}
 
+	g.reverseProxy.Mirror(ctx, proxyTarget)
 	g.reverseProxy.Proxy(ctx, proxyTarget).ServeHTTP(ctx.Writer, ctx.Request)
 
 }
@@ -267,13 +393,24 @@ func (g *GinBasedGateway) getProxyTarget(ctx *gin.Context) (*url.URL, int, error
 	if target == "" {
 		return nil, http.StatusBadGateway, fmt.Errorf("proxy target not set: %s\n", g.contextError(ctx))
 	}
-	proxyTarget, err := url.Parse(fmt.Sprintf("%s%s", target, queryParams(ctx, "&")))
+	// target URL path is escaped; query string is forwarded exactly as received
+	proxyTarget, err := url.Parse(target)
 	if err != nil {
-		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return nil, http.StatusInternalServerError, err
 	}
+	proxyTarget.RawQuery = ctx.Request.URL.RawQuery
 	return proxyTarget, 0, nil
 }
 
+func (g *GinBasedGateway) getProxyInstance(ctx *gin.Context) *registry.Instance {
+	value, ok := ctx.Get(constants.CtxProxyInstance)
+	if !ok {
+		return nil
+	}
+	instance, _ := value.(*registry.Instance)
+	return instance
+}
+
 func (g *GinBasedGateway) contextError(ctx *gin.Context) string {
 	v, ok := ctx.Get(constants.CtxError)
 	if !ok {
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/certificate"
 	"github.com/slink-go/api-gateway/cmd/common"
 	"github.com/slink-go/api-gateway/cmd/common/variables"
 	"github.com/slink-go/api-gateway/discovery"
 	"github.com/slink-go/api-gateway/middleware/auth"
+	"github.com/slink-go/api-gateway/middleware/client"
 	"github.com/slink-go/api-gateway/middleware/rate"
 	"github.com/slink-go/api-gateway/middleware/security"
 	"github.com/slink-go/api-gateway/proxy"
@@ -49,28 +52,39 @@ func main() {
 
 	ec := createEurekaClient()
 	dc := createDiscoClient()
+	kc := createK8sClient()
+	cc := createConsulClient()
+	nc := createDnsClient()
 	sc := createStaticClient()
 
-	<-startGateway(sPort, mPort, ec, dc, sc)
+	<-startGateway(sPort, mPort, ec, dc, kc, cc, nc, sc)
 	time.Sleep(10 * time.Millisecond)
 }
 
 func startGateway(proxyAddr, monitoringAddr string, dc ...discovery.Client) chan struct{} {
 	reg := registry.NewServiceRegistry(dc...)
 	res := resolver.NewServiceResolver(reg)
-	proc := resolver.NewPathProcessor()
+	proc := createPathProcessor()
 	ap := createAuthChain()
 	udp := createUserDetailsProvider(ap, res, proc)
-	pr := createReverseProxy(res, proc)
+	splitter := createTrafficSplitter()
+	transports := proxy.NewTransportPool(proxy.NewTransportSettings())
+	reg.UseTransports(transports) // health checks use upstream connections settings
+	pr := createReverseProxy(res, proc, splitter, transports)
 	limiter := createRateLimiter()
+	clientAddress := createClientAddressResolver()
+	tlsConfig := createTLSConfig()
 	quitChn := make(chan struct{})
 	go NewGinBasedGateway(
 		WithAuthProvider(ap),
 		WithUserDetailsCache(auth.NewUserDetailsCache(env.DurationOrDefault(variables.AuthCacheTTL, time.Second*30))),
 		WithUserDetailsProvider(udp),
 		WithRateLimiter(limiter),
+		WithClientAddressResolver(clientAddress),
+		WithTLSConfig(tlsConfig),
 		WithReverseProxy(pr),
 		WithRegistry(reg),
+		WithTrafficSplitter(splitter),
 		WithQuitChn(quitChn),
 	).Serve(proxyAddr, monitoringAddr)
 	return quitChn
@@ -124,6 +138,75 @@ func createDiscoClient() discovery.Client {
 	logging.GetLogger("main").Info("started disco registry")
 	return dc
 }
+func createK8sClient() discovery.Client {
+	if !env.BoolOrDefault(variables.K8sClientEnabled, false) {
+		return nil
+	}
+	kc := discovery.NewK8sClient(
+		discovery.NewK8sClientConfig().
+			WithUrl(env.StringOrDefault(variables.K8sUrl, "")).
+			WithToken(env.StringOrDefault(variables.K8sToken, "")).
+			WithTokenFile(env.StringOrDefault(variables.K8sTokenFile, "")).
+			WithCAFile(env.StringOrDefault(variables.K8sCAFile, "")).
+			WithInsecure(env.BoolOrDefault(variables.K8sInsecure, false)).
+			WithNamespace(env.StringOrDefault(variables.K8sNamespace, "")).
+			WithLabelSelector(env.StringOrDefault(variables.K8sLabelSelector, "")).
+			WithPortName(env.StringOrDefault(variables.K8sPortName, "")).
+			WithRetry(env.DurationOrDefault(variables.K8sRetryInterval, 5*time.Second)),
+	)
+	if err := kc.Connect(make(chan struct{})); err != nil {
+		logging.GetLogger("main").Warning("k8s client initialization error: %s", err)
+		return nil
+	}
+	logging.GetLogger("main").Info("started k8s registry")
+	return kc
+}
+func createConsulClient() discovery.Client {
+	if !env.BoolOrDefault(variables.ConsulClientEnabled, false) {
+		return nil
+	}
+	if env.StringOrDefault(variables.ConsulUrl, "") == "" {
+		panic("consul URL not set")
+	}
+	cc := discovery.NewConsulClient(
+		discovery.NewConsulClientConfig().
+			WithUrl(env.StringOrDefault(variables.ConsulUrl, "")).
+			WithToken(env.StringOrDefault(variables.ConsulToken, "")).
+			WithDatacenter(env.StringOrDefault(variables.ConsulDatacenter, "")).
+			WithTag(env.StringOrDefault(variables.ConsulTag, "")).
+			WithWaitTime(env.DurationOrDefault(variables.ConsulWaitTime, 5*time.Minute)).
+			WithRetry(env.DurationOrDefault(variables.ConsulRetryInterval, 5*time.Second)).
+			WithApplication(env.StringOrDefault(variables.GatewayName, "fiber-gateway")),
+	)
+	if err := cc.Connect(make(chan struct{})); err != nil {
+		logging.GetLogger("main").Warning("consul client initialization error: %s", err)
+		return nil
+	}
+	logging.GetLogger("main").Info("started consul registry")
+	return cc
+}
+func createDnsClient() discovery.Client {
+	if !env.BoolOrDefault(variables.DnsClientEnabled, false) {
+		return nil
+	}
+	nc := discovery.NewDnsClient(
+		discovery.NewDnsClientConfig().
+			WithServices(env.StringArrayOrEmpty(variables.DnsServices)...).
+			WithServers(env.StringArrayOrEmpty(variables.DnsServers)...).
+			WithTimeout(env.DurationOrDefault(variables.DnsTimeout, 2*time.Second)).
+			WithTTL(
+				env.DurationOrDefault(variables.DnsMinTTL, 5*time.Second),
+				env.DurationOrDefault(variables.DnsMaxTTL, 5*time.Minute),
+			).
+			WithRetry(env.DurationOrDefault(variables.DnsRetryInterval, 5*time.Second)),
+	)
+	if err := nc.Connect(make(chan struct{})); err != nil {
+		logging.GetLogger("main").Warning("dns client initialization error: %s", err)
+		return nil
+	}
+	logging.GetLogger("main").Info("started dns registry")
+	return nc
+}
 func createStaticClient() discovery.Client {
 	filePath := env.StringOrDefault(variables.StaticRegistryFile, "")
 	if filePath == "" {
@@ -134,10 +217,82 @@ func createStaticClient() discovery.Client {
 		logging.GetLogger("main").Error("static registry initialization error ('%s'): %s", filePath, err)
 		return nil
 	}
+	if err = v.Connect(make(chan struct{})); err != nil {
+		logging.GetLogger("main").Warning("static registry watch error ('%s'): %s", filePath, err)
+	}
 	logging.GetLogger("main").Info("started static registry")
 	return v
 }
 
+func createPathProcessor() resolver.PathProcessor {
+	options := []resolver.PathProcessorOption{
+		resolver.WithPreserveCase(env.BoolOrDefault(variables.PathPreserveCase, false)),
+		resolver.WithStrictPaths(env.BoolOrDefault(variables.PathStrict, false)),
+	}
+	if env.StringOrDefault(variables.PathPrefixes, "") != "" {
+		prefixes, err := resolver.ParsePathPrefixes(env.StringArrayOrEmpty(variables.PathPrefixes)...)
+		if err != nil {
+			panic(err)
+		}
+		options = append(options, resolver.WithPathPrefixes(prefixes...))
+	}
+	return resolver.NewPathProcessor(options...)
+}
+func createRouteTable() *resolver.RouteTable {
+	filePath := env.StringOrDefault(variables.RoutesFile, "")
+	if filePath == "" {
+		return nil
+	}
+	table, err := resolver.LoadRoutes(filePath)
+	if err != nil {
+		logging.GetLogger("main").Error("routes initialization error ('%s'): %s", filePath, err)
+		return nil
+	}
+	logging.GetLogger("main").Info("loaded %d route(s) from %s", len(table.Routes()), filePath)
+	return table
+}
+
+func createVirtualHosts() *resolver.VirtualHosts {
+	config := env.StringArrayOrEmpty(variables.VirtualHosts)
+	if len(config) == 0 {
+		return nil
+	}
+	vhosts, err := resolver.NewVirtualHosts(config...)
+	if err != nil {
+		logging.GetLogger("main").Error("virtual hosts initialization error: %s", err)
+		return nil
+	}
+	return vhosts
+}
+
+func createTrafficSplitter() *resolver.TrafficSplitter {
+	filePath := env.StringOrDefault(variables.TrafficSplitFile, "")
+	if filePath == "" {
+		return nil
+	}
+	splitter, err := resolver.LoadTrafficSplits(filePath)
+	if err != nil {
+		logging.GetLogger("main").Error("traffic splits initialization error ('%s'): %s", filePath, err)
+		return nil
+	}
+	logging.GetLogger("main").Info("loaded %d traffic split(s) from %s", len(splitter.Splits()), filePath)
+	return splitter
+}
+
+func createFallbacks() *resolver.Fallbacks {
+	filePath := env.StringOrDefault(variables.FallbackFile, "")
+	if filePath == "" {
+		return nil
+	}
+	fallbacks, err := resolver.LoadFallbacks(filePath)
+	if err != nil {
+		logging.GetLogger("main").Error("fallbacks initialization error ('%s'): %s", filePath, err)
+		return nil
+	}
+	logging.GetLogger("main").Info("loaded fallbacks from %s", filePath)
+	return fallbacks
+}
+
 func createAuthChain() security.AuthProvider {
 	return security.NewAuthChain(
 		security.WithProvider(security.NewHttpHeaderAuthProvider()),
@@ -154,8 +309,80 @@ func createUserDetailsProvider(ap security.AuthProvider, res resolver.ServiceRes
 		security.UdpWithResponseParser(security.NewResponseParser(security.WithMappingFile(os.Getenv(variables.AuthResponseMappingFilePath)))),
 	)
 }
-func createReverseProxy(res resolver.ServiceResolver, proc resolver.PathProcessor) *proxy.ReverseProxy {
-	return proxy.CreateReverseProxy().WithServiceResolver(res).WithPathProcessor(proc)
+func createReverseProxy(res resolver.ServiceResolver, proc resolver.PathProcessor, splitter *resolver.TrafficSplitter, transports *proxy.TransportPool) *proxy.ReverseProxy {
+	reverseProxy := proxy.CreateReverseProxy().
+		WithServiceResolver(res).
+		WithTransportPool(transports).
+		WithPathProcessor(proc).
+		WithRouteTable(createRouteTable()).
+		WithVirtualHosts(createVirtualHosts()).
+		WithTrafficSplitter(splitter).
+		WithFallbacks(createFallbacks())
+	if env.BoolOrDefault(variables.RetryEnabled, false) {
+		policy, err := proxy.NewRetryPolicy()
+		if err != nil {
+			logging.GetLogger("main").Warning("retries disabled: %s", err)
+		} else {
+			reverseProxy.WithRetryPolicy(policy)
+		}
+	}
+	mirrorPolicy, err := proxy.NewMirrorPolicy()
+	if err != nil {
+		logging.GetLogger("main").Warning("mirroring disabled: %s", err)
+	} else {
+		reverseProxy.WithMirrorPolicy(mirrorPolicy)
+	}
+	forwardingPolicy, err := proxy.NewForwardingPolicy()
+	if err != nil {
+		logging.GetLogger("main").Warning("default forwarding headers: %s", err)
+	} else {
+		reverseProxy.WithForwardingPolicy(forwardingPolicy)
+	}
+	errorPolicy, err := proxy.NewErrorPolicy()
+	if err != nil {
+		logging.GetLogger("main").Warning("default upstream error handling: %s", err)
+	} else {
+		reverseProxy.WithErrorPolicy(errorPolicy)
+	}
+	return reverseProxy
+}
+func createClientAddressResolver() *client.AddressResolver {
+	source, err := client.ParseSource(env.StringOrDefault(variables.ClientIpSource, ""))
+	if err != nil {
+		panic(err)
+	}
+	trusted, err := client.WithTrustedProxies(env.StringArrayOrEmpty(variables.ClientIpTrustedProxies)...)
+	if err != nil {
+		panic(err)
+	}
+	return client.NewAddressResolver(
+		client.WithSource(source),
+		trusted,
+		client.WithTrustedHops(int(env.Int64OrDefault(variables.ClientIpTrustedHops, 0))),
+	)
+}
+func createTLSConfig() *tls.Config {
+	if !env.BoolOrDefault(variables.TlsEnabled, false) {
+		return nil
+	}
+	pairs, err := certificate.ParsePairs(env.StringArrayOrEmpty(variables.TlsCertificates)...)
+	if err != nil {
+		panic(err)
+	}
+	store, err := certificate.NewStore(env.StringOrDefault(variables.TlsCertDir, ""), pairs...)
+	if err != nil {
+		panic(fmt.Sprintf("TLS initialization error: %s", err))
+	}
+	minVersion, err := certificate.ParseVersion(env.StringOrDefault(variables.TlsMinVersion, ""))
+	if err != nil {
+		panic(err)
+	}
+	cipherSuites, err := certificate.ParseCipherSuites(env.StringArrayOrEmpty(variables.TlsCipherSuites)...)
+	if err != nil {
+		panic(err)
+	}
+	store.Watch(env.DurationOrDefault(variables.TlsCertPollInterval, 30*time.Second))
+	return store.TLSConfig(minVersion, cipherSuites)
 }
 func createRateLimiter() rate.Limiter {
 	var options []rate.Option
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
+	helmet "github.com/danielkov/gin-helmet"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/palantir/stacktrace"
 	"github.com/slink-go/api-gateway/middleware/auth"
+	"github.com/slink-go/api-gateway/middleware/client"
 	"github.com/slink-go/api-gateway/middleware/constants"
 	"github.com/slink-go/api-gateway/middleware/rate"
 	"github.com/slink-go/api-gateway/middleware/security"
 	"github.com/slink-go/api-gateway/proxy"
 	"github.com/slink-go/api-gateway/registry"
-	"github.com/slink-go/api-gateway/resolver"
 	"github.com/slink-go/gin-timeout"
 	"github.com/slink-go/logging"
 	"github.com/slink-go/util/matcher"
@@ -39,7 +42,7 @@ func customLogger() gin.HandlerFunc {
 			latency = latency.Truncate(time.Microsecond)
 		}
 		logger.Info("%15v %10v %7v %10v %v",
-			c.ClientIP(),
+			clientIp(c),
 			latency,
 			c.Writer.Status(),
 			c.Request.Method,
@@ -48,6 +51,71 @@ func customLogger() gin.HandlerFunc {
 	}
 }
 
+// endregion
+// region - request id - identify request in gateway and upstream logs and error responses
+
+func requestId() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(constants.HdrRequestId)
+		if !validRequestId(id) {
+			id = uuid.New().String()
+		}
+		ctx.Request.Header.Set(constants.HdrRequestId, id)
+		ctx.Header(constants.HdrRequestId, id)
+		ctx.Set(constants.CtxRequestId, id)
+	}
+}
+
+// validRequestId checks if incoming request id can be reused (is short and printable)
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// endregion
+// region - client address - resolve real client IP (considering trusted proxies)
+
+func clientAddress(resolver *client.AddressResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ip := resolver.Resolve(ctx.Request)
+		ctx.Set(constants.CtxClientIp, ip)
+		ctx.Set(constants.CtxTrustedPeer, resolver.TrustedPeer(ctx.Request))
+	}
+}
+
+// clientIp returns client IP resolved by clientAddress middleware
+func clientIp(ctx *gin.Context) string {
+	if ip := ctx.GetString(constants.CtxClientIp); ip != "" {
+		return ip
+	}
+	return ctx.RemoteIP()
+}
+
+// endregion
+// region - security headers
+
+// securityHeaders returns helmet middlewares; HSTS header is sent only for HTTPS requests
+// (served with TLS, or forwarded by trusted proxy which terminates TLS)
+func securityHeaders(hstsMaxAge int64, includeSubdomains bool) []gin.HandlerFunc {
+	result := []gin.HandlerFunc{helmet.NoSniff(), helmet.DNSPrefetchControl(), helmet.FrameGuard(), helmet.IENoOpen(), helmet.XSSFilter()}
+	if hstsMaxAge <= 0 {
+		return result
+	}
+	hsts := helmet.SetHSTS(includeSubdomains, int(hstsMaxAge))
+	return append(result, func(ctx *gin.Context) {
+		if ctx.Request.TLS != nil || ctx.GetBool(constants.CtxTrustedPeer) && strings.EqualFold(ctx.GetHeader("X-Forwarded-Proto"), "https") {
+			hsts(ctx)
+		}
+	})
+}
+
 // endregion
 // region - headersCleaner - cleanup incoming headers to prevent security issues
 
@@ -70,33 +138,55 @@ func headersCleaner(headers ...string) gin.HandlerFunc {
 // endregion
 // region - proxy target resolver - resolve request URL to target service URL
 
-func proxyTargetResolver(reverseProxy *proxy.ReverseProxy) gin.HandlerFunc {
+// proxyTargetResolver resolves request proxy target; dry run only checks that request can be resolved
+// (errors and fallback responses are written), target is not selected (see registry.Hint DryRun)
+func proxyTargetResolver(reverseProxy *proxy.ReverseProxy, affinity *affinity, dryRun bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		logger := logging.GetLogger("resolver-middleware")
 		logger.Trace("[resolver] handle")
-		target, err := reverseProxy.ResolveTarget(ctx.Request.URL.Path)
+		var hint registry.Hint
+		target, err := reverseProxy.ResolveTarget(ctx.Request, func(service string) registry.Hint {
+			hint = affinity.hint(ctx, service)
+			hint.DryRun = dryRun
+			return hint
+		})
 		if err != nil {
 			logger.Trace("%s", stacktrace.RootCause(err))
-			switch err.(type) {
-			case *resolver.ErrEmptyBaseUrl:
-				_, _ = ctx.Writer.WriteString(err.Error())
-				_, _ = ctx.Writer.WriteString("\n")
-				_ = ctx.AbortWithError(http.StatusBadRequest, err)
-			case *resolver.ErrInvalidPath:
-				_, _ = ctx.Writer.WriteString(err.Error())
-				_, _ = ctx.Writer.WriteString("\n")
-				_ = ctx.AbortWithError(http.StatusBadRequest, err)
-			case *registry.ErrServiceUnavailable:
-				_, _ = ctx.Writer.WriteString(err.Error())
-				_, _ = ctx.Writer.WriteString("\n")
-				ctx.AbortWithStatus(http.StatusServiceUnavailable)
-			}
-		} else {
+			_ = ctx.Error(err)
+			proxy.WriteProblem(ctx.Writer, ctx.Request, proxy.ErrorProblem(ctx.Request, err))
+			ctx.Abort()
+		} else if target.Response != nil {
+			logger.Trace("%s: fallback response (service: %s)", ctx.Request.URL.Path, target.Service)
+			target.Response.Write(ctx.Writer)
+			ctx.Abort()
+		} else if !dryRun {
 			logger.Trace(
-				"resolved url: %s://%s%s%s -> %s",
-				ctx.Request.URL.Scheme, ctx.Request.Host, ctx.Request.URL.Path, queryParams(ctx, ", "), target,
+				"resolved url: %s://%s%s -> %s (route: %s)",
+				ctx.Request.URL.Scheme, ctx.Request.Host, ctx.Request.URL.RequestURI(), target.Url, target.Route,
 			)
-			ctx.Set(constants.CtxProxyTarget, target.String())
+			ctx.Set(constants.CtxProxyTarget, target.Url)
+			ctx.Set(constants.CtxProxyInstance, target.Instance)
+			for k, v := range target.Headers {
+				for _, value := range v {
+					ctx.Request.Header.Add(k, value)
+				}
+			}
+			if target.Status != 0 {
+				ctx.Set(constants.CtxProxyStatus, target.Status)
+			}
+			if target.Service != "" {
+				ctx.Set(constants.CtxProxyService, target.Service)
+			}
+			if target.Mirror != nil {
+				ctx.Set(constants.CtxProxyMirror, target.Mirror)
+			}
+			if target.Prefix != "" {
+				ctx.Set(constants.CtxProxyPrefix, target.Prefix)
+			}
+			if target.Resolver != nil {
+				ctx.Set(constants.CtxProxyResolver, target.Resolver)
+			}
+			affinity.pin(ctx, target.Service, hint, target.Instance)
 		}
 	}
 }
@@ -313,7 +403,7 @@ func getWait(lmtr *limiter.Limiter, c *gin.Context) (int64, error) {
 	return wait, nil
 }
 func rateLimitKeyGetter(ctx *gin.Context) string {
-	realIp := ctx.ClientIP() // TODO: use correct way to find "trusted" client ip (see TODO.md)
+	realIp := clientIp(ctx)
 	v, ok := ctx.Get(constants.CtxRateLimiter)
 	if !ok {
 		return realIp
@@ -326,11 +416,23 @@ func rateLimitKeyGetter(ctx *gin.Context) string {
 }
 
 // endregion
+// region - api token - protect monitoring endpoints which change gateway state
 
-//func circuitBreakerMiddleware()
+// apiToken requires "Authorization: Bearer {token}" header; if token is not set, endpoint is disabled
+func apiToken(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token == "" {
+			ctx.String(http.StatusForbidden, "read-only: API token is not configured\n")
+			ctx.Abort()
+			return
+		}
+		value, ok := strings.CutPrefix(ctx.GetHeader(constants.HdrAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(value)), []byte(token)) != 1 {
+			ctx.Header("WWW-Authenticate", "Bearer")
+			ctx.String(http.StatusUnauthorized, "invalid API token\n")
+			ctx.Abort()
+		}
+	}
+}
 
-//func realIp() gin.HandlerFunc {
-//	return func(ctx *gin.Context) {
-//		ctx.Header("X-Real-Ip", ctx.ClientIP())
-//	}
-//}
+// endregion
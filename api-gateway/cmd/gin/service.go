@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/slink-go/logging"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -31,20 +33,63 @@ type Service struct {
 	logger                  logging.Logger
 	gracefulShutdownTimeout time.Duration
 	quitChn                 chan struct{}
+	tlsConfig               *tls.Config
+	redirectAddress         string // plain HTTP listener address redirecting to HTTPS
 }
 
 func (s *Service) Run(address string) {
 	server := &http.Server{
-		Addr:    address,
-		Handler: s.engine,
+		Addr:      address,
+		Handler:   s.engine,
+		TLSConfig: s.tlsConfig,
 	}
+	servers := []*http.Server{server}
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.tlsConfig != nil {
+			// certificates are provided by TLS config
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Panic("[service][%s] listen: %s\n", address, err)
 		}
 	}()
-	s.logger.Info("start %s service on %s", s.name, address)
-	s.handleBreak(server)
+	if s.tlsConfig != nil && s.redirectAddress != "" {
+		redirect := &http.Server{
+			Addr:    s.redirectAddress,
+			Handler: httpsRedirect(address),
+		}
+		servers = append(servers, redirect)
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.logger.Panic("[service][%s] listen: %s\n", s.redirectAddress, err)
+			}
+		}()
+		s.logger.Info("start %s HTTPS redirect on %s", s.name, s.redirectAddress)
+	}
+	s.logger.Info("start %s service on %s (TLS: %v)", s.name, address, s.tlsConfig != nil)
+	s.handleBreak(servers...)
+}
+
+// httpsRedirect redirects plain HTTP requests to HTTPS listener
+func httpsRedirect(address string) http.Handler {
+	_, port, _ := net.SplitHostPort(address)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		status := http.StatusPermanentRedirect // keeps request method and body
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
 }
 
 func (s *Service) WithMiddleware(middleware ...gin.HandlerFunc) *Service {
@@ -108,13 +153,22 @@ func (s *Service) RateLimit(rps int) *Service {
 	return s
 }
 
+func (s *Service) WithTLS(config *tls.Config) *Service {
+	s.tlsConfig = config
+	return s
+}
+func (s *Service) WithHttpsRedirect(address string) *Service {
+	s.redirectAddress = address
+	return s
+}
+
 func (s *Service) WithQuitChn(chn chan struct{}) *Service {
 	s.quitChn = chn
 	return s
 }
 
-func (s *Service) handleBreak(server *http.Server) {
-	sigChn := make(chan os.Signal)
+func (s *Service) handleBreak(servers ...*http.Server) {
+	sigChn := make(chan os.Signal, 1)
 	signal.Notify(sigChn, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
 	for {
 		switch <-sigChn {
@@ -128,7 +182,9 @@ func (s *Service) handleBreak(server *http.Server) {
 				s.quitChn <- struct{}{}
 			}
 			close(sigChn)
-			s.shutdownHttpServer(server)
+			for _, server := range servers {
+				s.shutdownHttpServer(server)
+			}
 			if s.quitChn != nil {
 				s.quitChn <- struct{}{}
 			}
@@ -0,0 +1,287 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/slink-go/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const consulIndexHeader = "X-Consul-Index"
+
+func NewConsulClient(config *consulConfig) Client {
+	return &consulClient{
+		config:   *config,
+		logger:   logging.GetLogger("consul-client"),
+		client:   &http.Client{},
+		services: make(map[string][]consulServiceEntry),
+		watchers: make(map[string]context.CancelFunc),
+		sigChn:   make(chan os.Signal, 1),
+	}
+}
+
+type consulClient struct {
+	config        consulConfig
+	mutex         sync.RWMutex
+	client        *http.Client
+	logger        logging.Logger
+	services      map[string][]consulServiceEntry // service name -> passing instances
+	watchers      map[string]context.CancelFunc   // service name -> health watcher
+	sigChn        chan os.Signal
+	Notifications chan struct{}
+}
+
+func (c *consulClient) Connect(options ...interface{}) error {
+	if c.config.url == "" {
+		return fmt.Errorf("consul url is empty")
+	}
+	if len(options) > 0 {
+		if chn, ok := options[0].(chan struct{}); ok {
+			c.Notifications = chn
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.watchCatalog(ctx)
+	go c.handleSignal(cancel)
+	return nil
+}
+func (c *consulClient) Services() *Remotes {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	result := Remotes{}
+	for name, entries := range c.services {
+		for _, entry := range entries {
+			host := entry.Service.Address
+			if host == "" {
+				host = entry.Node.Address
+			}
+			r := Remote{
+				App:    name,
+				Scheme: entry.scheme(),
+				Host:   host,
+				Port:   entry.Service.Port,
+				Status: "UP",
+				Weight: entry.Service.Weights.Passing,
+				Tags:   entry.Service.Tags,
+			}.WithMeta(entry.Service.Meta)
+			c.logger.Debug("add %s: %s", name, r)
+			result.Add(name, r)
+		}
+	}
+	return &result
+}
+func (c *consulClient) NotificationsChn() chan struct{} {
+	return c.Notifications
+}
+
+// watchCatalog tracks the list of services registered in consul and
+// runs a blocking health query watcher for each of them
+func (c *consulClient) watchCatalog(ctx context.Context) {
+	var index uint64
+	for {
+		var catalog map[string][]string
+		next, err := c.query(ctx, "/v1/catalog/services", nil, index, &catalog)
+		if ctx.Err() != nil {
+			c.stopWatchers()
+			return
+		}
+		if err != nil {
+			c.logger.Warning("catalog query error: %s", strings.TrimSpace(err.Error()))
+			index = 0
+			c.sleep(ctx)
+			continue
+		}
+		if next == index {
+			continue
+		}
+		index = next
+
+		removed := false
+		for name := range catalog {
+			if c.skip(name) {
+				continue
+			}
+			if _, ok := c.watchers[name]; !ok {
+				watcherCtx, cancel := context.WithCancel(ctx)
+				c.watchers[name] = cancel
+				go c.watchService(watcherCtx, name)
+			}
+		}
+		for name, cancel := range c.watchers {
+			if _, ok := catalog[name]; !ok {
+				cancel()
+				delete(c.watchers, name)
+				c.mutex.Lock()
+				delete(c.services, name)
+				c.mutex.Unlock()
+				removed = true
+			}
+		}
+		if removed {
+			c.notify()
+		}
+	}
+}
+func (c *consulClient) watchService(ctx context.Context, name string) {
+	var index uint64
+	params := url.Values{}
+	params.Set("passing", "true")
+	if c.config.tag != "" {
+		params.Set("tag", c.config.tag)
+	}
+	for {
+		var entries []consulServiceEntry
+		next, err := c.query(ctx, "/v1/health/service/"+url.PathEscape(name), params, index, &entries)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.logger.Warning("%s health query error: %s", name, strings.TrimSpace(err.Error()))
+			index = 0
+			c.sleep(ctx)
+			continue
+		}
+		if next == index {
+			continue
+		}
+		index = next
+		if !c.update(ctx, name, entries) {
+			return
+		}
+		c.logger.Trace("%s: %d passing instance(s) (index %d)", name, len(entries), index)
+		c.notify()
+	}
+}
+
+// update stores service instances unless service watcher is cancelled (service is deregistered):
+// cancelled watcher may complete its query after service removal and should not bring it back
+func (c *consulClient) update(ctx context.Context, name string, entries []consulServiceEntry) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	c.services[name] = entries
+	return true
+}
+
+// query performs consul blocking query; returned index should be used for the next call
+func (c *consulClient) query(ctx context.Context, path string, params url.Values, index uint64, result any) (uint64, error) {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if c.config.datacenter != "" {
+		query.Set("dc", c.config.datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.config.waitTime.String())
+	}
+
+	// consul adds up to wait/16 jitter to blocking query wait time
+	queryCtx, cancel := context.WithTimeout(ctx, c.config.waitTime+c.config.waitTime/16+10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(queryCtx, http.MethodGet, c.config.url+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.config.token != "" {
+		request.Header.Set("X-Consul-Token", c.config.token)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return 0, fmt.Errorf("unexpected response %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err = json.NewDecoder(response.Body).Decode(result); err != nil {
+		return 0, err
+	}
+
+	next, err := strconv.ParseUint(response.Header.Get(consulIndexHeader), 10, 64)
+	if err != nil || next == 0 {
+		return 0, fmt.Errorf("invalid %s header value: '%s'", consulIndexHeader, response.Header.Get(consulIndexHeader))
+	}
+	if next < index {
+		// index went backwards (e.g. consul state restored from snapshot) - start over
+		return 0, nil
+	}
+	return next, nil
+}
+
+func (c *consulClient) skip(name string) bool {
+	return name == "consul" || strings.EqualFold(name, c.config.application)
+}
+func (c *consulClient) stopWatchers() {
+	for name, cancel := range c.watchers {
+		cancel()
+		delete(c.watchers, name)
+	}
+}
+func (c *consulClient) sleep(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.config.retryInterval):
+	}
+}
+func (c *consulClient) notify() {
+	if c.Notifications != nil {
+		c.Notifications <- struct{}{}
+	}
+}
+func (c *consulClient) handleSignal(cancel context.CancelFunc) {
+	signal.Notify(c.sigChn, syscall.SIGTERM, syscall.SIGINT)
+	<-c.sigChn
+	c.logger.Info("receive exit signal")
+	cancel()
+}
+
+// region - consul api model
+
+type consulServiceEntry struct {
+	Node struct {
+		Node       string `json:"Node"`
+		Address    string `json:"Address"`
+		Datacenter string `json:"Datacenter"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Service string            `json:"Service"`
+		Tags    []string          `json:"Tags"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+		Weights struct {
+			Passing int `json:"Passing"`
+			Warning int `json:"Warning"`
+		} `json:"Weights"`
+	} `json:"Service"`
+}
+
+// scheme is derived from service tags; if not tagged, "scheme" and "secure" metadata keys are used (see Remote.WithMeta)
+func (e consulServiceEntry) scheme() string {
+	for _, tag := range e.Service.Tags {
+		if strings.EqualFold(tag, "https") || strings.EqualFold(tag, "secure") {
+			return "https"
+		}
+	}
+	return ""
+}
+
+// endregion
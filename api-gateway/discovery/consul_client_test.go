@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const consulTestHealth = `[
+	{
+		"Node": {"Node": "node-1", "Address": "10.0.0.1", "Datacenter": "dc1"},
+		"Service": {"ID": "service-a-1", "Service": "service-a", "Tags": ["https", "v1"], "Address": "", "Port": 8443, "Meta": {"version": "1.0", "zone": "z1"}, "Weights": {"Passing": 3, "Warning": 1}}
+	}%s
+]`
+const consulTestSecondInstance = `,
+	{
+		"Node": {"Node": "node-2", "Address": "10.0.0.2", "Datacenter": "dc1"},
+		"Service": {"ID": "service-a-2", "Service": "service-a", "Tags": [], "Address": "10.0.1.2", "Port": 8080, "Meta": {}}
+	}`
+
+func TestConsulClient(t *testing.T) {
+
+	var healthIndex atomic.Uint64
+	healthIndex.Store(100)
+	changed := make(chan uint64)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "test-token" || r.URL.Query().Get("dc") != "dc1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			if index == 10 {
+				<-r.Context().Done() // block: catalog never changes
+				return
+			}
+			w.Header().Set(consulIndexHeader, "10")
+			_, _ = w.Write([]byte(`{"consul": [], "gw": [], "service-a": ["https"]}`))
+		case "/v1/health/service/service-a":
+			assert.Equal(t, "true", r.URL.Query().Get("passing"))
+			if index == healthIndex.Load() {
+				select {
+				case <-r.Context().Done():
+					return
+				case next := <-changed:
+					healthIndex.Store(next)
+				}
+			}
+			current := healthIndex.Load()
+			w.Header().Set(consulIndexHeader, strconv.FormatUint(current, 10))
+			if current == 100 {
+				_, _ = fmt.Fprintf(w, consulTestHealth, "")
+			} else {
+				_, _ = fmt.Fprintf(w, consulTestHealth, consulTestSecondInstance)
+			}
+		default:
+			t.Errorf("unexpected consul query: %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer server.CloseClientConnections()
+
+	notifications := make(chan struct{})
+	client := NewConsulClient(
+		NewConsulClientConfig().
+			WithUrl(server.URL).
+			WithToken("test-token").
+			WithDatacenter("dc1").
+			WithApplication("GW").
+			WithWaitTime(time.Second),
+	)
+	assert.NoError(t, client.Connect(notifications))
+
+	waitNotification(t, notifications)
+	remotes := client.Services().Get("service-a")
+	assert.Len(t, remotes, 1)
+	assert.Equal(t, "https://10.0.0.1:8443", remotes[0].String())
+	assert.Equal(t, []string{"https", "v1"}, remotes[0].Tags)
+	assert.Equal(t, "1.0", remotes[0].Meta["version"])
+	assert.Equal(t, "1.0", remotes[0].Version)
+	assert.Equal(t, "z1", remotes[0].Zone)
+	assert.Equal(t, 3, remotes[0].Weight)
+	assert.Len(t, client.Services().List(), 1)
+
+	changed <- 101
+	waitNotification(t, notifications)
+	remotes = client.Services().Get("service-a")
+	assert.Len(t, remotes, 2)
+	assert.Equal(t, "http://10.0.1.2:8080", remotes[1].String())
+}
+
+func TestConsulClientCancelledWatcher(t *testing.T) {
+	client := NewConsulClient(NewConsulClientConfig()).(*consulClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.True(t, client.update(ctx, "service-a", []consulServiceEntry{{}}))
+	assert.Len(t, client.services, 1)
+
+	// service is deregistered (see watchCatalog): late result of its watcher is dropped
+	cancel()
+	client.mutex.Lock()
+	delete(client.services, "service-a")
+	client.mutex.Unlock()
+	assert.False(t, client.update(ctx, "service-a", []consulServiceEntry{{}}))
+	assert.Empty(t, client.services)
+}
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"strings"
+	"time"
+)
+
+func NewConsulClientConfig() *consulConfig {
+	return &consulConfig{
+		application:   "UNKNOWN",
+		waitTime:      5 * time.Minute,
+		retryInterval: 5 * time.Second,
+	}
+}
+
+type consulConfig struct {
+	url           string        // consul agent url
+	token         string        // [optional] consul ACL token
+	datacenter    string        // [optional] datacenter to query (agent's datacenter, if empty)
+	tag           string        // [optional] only use service instances having this tag
+	application   string        // application name (excluded from discovered services)
+	waitTime      time.Duration // blocking query max wait time
+	retryInterval time.Duration // delay before repeating failed query
+}
+
+func (c *consulConfig) WithUrl(url string) *consulConfig {
+	c.url = strings.TrimSuffix(url, "/")
+	return c
+}
+func (c *consulConfig) WithToken(token string) *consulConfig {
+	c.token = token
+	return c
+}
+func (c *consulConfig) WithDatacenter(datacenter string) *consulConfig {
+	c.datacenter = datacenter
+	return c
+}
+func (c *consulConfig) WithTag(tag string) *consulConfig {
+	c.tag = tag
+	return c
+}
+func (c *consulConfig) WithApplication(name string) *consulConfig {
+	c.application = name
+	return c
+}
+func (c *consulConfig) WithWaitTime(wait time.Duration) *consulConfig {
+	if wait > 0 {
+		c.waitTime = wait
+	}
+	return c
+}
+func (c *consulConfig) WithRetry(interval time.Duration) *consulConfig {
+	if interval > 0 {
+		c.retryInterval = interval
+	}
+	return c
+}
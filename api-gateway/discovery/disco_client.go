@@ -77,7 +77,10 @@ func (c *discoClient) Services() *Remotes {
 	for _, v := range c.client.Registry().List() {
 		if da.ClientStateUp == v.State() && v.ServiceId() != appId {
 			ep, err := v.Endpoint(da.HttpEndpoint)
-			if err != nil {
+			if err == nil && ep == "" {
+				ep, err = v.Endpoint(da.HttpsEndpoint)
+			}
+			if err != nil || ep == "" {
 				c.logger.Warning("could not find HTTP endpoint for %s", v.ServiceId())
 				continue
 			}
@@ -88,7 +91,7 @@ func (c *discoClient) Services() *Remotes {
 				Host:   host,
 				Port:   port,
 				Status: "UP",
-			}
+			}.WithMeta(discoMeta(v))
 			c.logger.Debug("add %s: %s", v.ServiceId(), remote)
 			result.Add(v.ServiceId(), remote)
 		}
@@ -98,3 +101,15 @@ func (c *discoClient) Services() *Remotes {
 func (c *discoClient) NotificationsChn() chan struct{} {
 	return c.Notifications
 }
+
+// discoMeta collects well-known metadata fields of registered disco client
+// (disco client API exposes meta values by key only)
+func discoMeta(v d.Client) map[string]string {
+	result := make(map[string]string)
+	for _, key := range []string{MetaZone, MetaWeight, MetaVersion, MetaScheme, MetaSecure} {
+		if value, ok := v.Field(key); ok && value != nil {
+			result[key] = fmt.Sprint(value)
+		}
+	}
+	return result
+}
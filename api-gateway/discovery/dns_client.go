@@ -0,0 +1,368 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/slink-go/logging"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func NewDnsClient(config *dnsConfig) Client {
+	return &dnsClient{
+		config:  *config,
+		logger:  logging.GetLogger("dns-client"),
+		remotes: make(map[string][]Remote),
+		sigChn:  make(chan os.Signal, 1),
+	}
+}
+
+type dnsClient struct {
+	config        dnsConfig
+	resolver      dnsResolver
+	mutex         sync.RWMutex
+	logger        logging.Logger
+	remotes       map[string][]Remote // service name -> last successfully resolved remotes
+	sigChn        chan os.Signal
+	Notifications chan struct{}
+}
+
+func (c *dnsClient) Connect(options ...interface{}) error {
+	if len(c.config.services) == 0 {
+		return fmt.Errorf("dns services are not set")
+	}
+	queries := make(map[string]dnsQuery, len(c.config.services))
+	for name, input := range c.config.services {
+		if name == "" {
+			return fmt.Errorf("empty service name for dns query '%s'", input)
+		}
+		query, err := parseDnsQuery(input)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		queries[name] = query
+	}
+	if c.resolver == nil {
+		c.resolver = &dnsExchangeResolver{
+			servers: c.config.getServers(),
+			timeout: c.config.timeout,
+		}
+	}
+	if len(options) > 0 {
+		if chn, ok := options[0].(chan struct{}); ok {
+			c.Notifications = chn
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	for name, query := range queries {
+		go c.watch(ctx, name, query)
+	}
+	go c.handleSignal(cancel)
+	return nil
+}
+func (c *dnsClient) Services() *Remotes {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	result := Remotes{}
+	for name, remotes := range c.remotes {
+		for _, r := range remotes {
+			c.logger.Debug("add %s: %s", name, r)
+			result.Add(name, r)
+		}
+	}
+	return &result
+}
+func (c *dnsClient) NotificationsChn() chan struct{} {
+	return c.Notifications
+}
+
+// watch re-resolves service query when previous answer's TTL expires;
+// on lookup failure last known answer is kept
+func (c *dnsClient) watch(ctx context.Context, name string, query dnsQuery) {
+	for {
+		remotes, ttl, err := c.resolve(ctx, name, query)
+		delay := c.config.retryInterval
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Warning("%s (%s) lookup error: %s", name, query.name, err)
+		} else {
+			delay = min(max(ttl, c.config.minTTL), c.config.maxTTL)
+			if c.update(name, remotes) {
+				c.logger.Trace("%s: %d instance(s) resolved (ttl %s)", name, len(remotes), ttl)
+				c.notify()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+func (c *dnsClient) resolve(ctx context.Context, name string, query dnsQuery) ([]Remote, time.Duration, error) {
+	var result []Remote
+	if query.srv {
+		records, ttl, err := c.resolver.LookupSRV(ctx, query.name)
+		if err != nil {
+			return nil, 0, err
+		}
+		// only the most preferred (lowest priority value) targets are used
+		priority := -1
+		for _, record := range records {
+			if priority < 0 || record.priority < priority {
+				priority = record.priority
+			}
+		}
+		for _, record := range records {
+			if record.priority != priority {
+				continue
+			}
+			result = append(result, Remote{
+				App:    name,
+				Scheme: query.scheme,
+				Host:   record.host,
+				Port:   record.port,
+				Status: "UP",
+				Weight: record.weight,
+			})
+		}
+		return result, ttl, nil
+	}
+	addresses, ttl, err := c.resolver.LookupIP(ctx, query.name)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, address := range addresses {
+		result = append(result, Remote{
+			App:    name,
+			Scheme: query.scheme,
+			Host:   address,
+			Port:   query.port,
+			Status: "UP",
+		})
+	}
+	return result, ttl, nil
+}
+
+// update stores resolved remotes and reports if answer set has changed
+func (c *dnsClient) update(name string, remotes []Remote) bool {
+	key := func(list []Remote) []string {
+		result := make([]string, 0, len(list))
+		for _, r := range list {
+			result = append(result, r.String()+"#"+strconv.Itoa(r.Weight))
+		}
+		slices.Sort(result)
+		return result
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	previous, ok := c.remotes[name]
+	if ok && slices.Equal(key(previous), key(remotes)) {
+		return false
+	}
+	c.remotes[name] = remotes
+	return true
+}
+func (c *dnsClient) notify() {
+	if c.Notifications != nil {
+		c.Notifications <- struct{}{}
+	}
+}
+func (c *dnsClient) handleSignal(cancel context.CancelFunc) {
+	signal.Notify(c.sigChn, syscall.SIGTERM, syscall.SIGINT)
+	<-c.sigChn
+	c.logger.Info("receive exit signal")
+	cancel()
+}
+
+// region - resolver
+
+type dnsRecord struct {
+	host     string
+	port     int
+	weight   int
+	priority int
+}
+
+// dnsResolver performs DNS lookups returning answers along with their TTL
+// (stdlib net.Resolver does not expose record TTLs)
+type dnsResolver interface {
+	LookupSRV(ctx context.Context, name string) ([]dnsRecord, time.Duration, error)
+	LookupIP(ctx context.Context, name string) ([]string, time.Duration, error)
+}
+
+type dnsExchangeResolver struct {
+	servers []string
+	timeout time.Duration
+}
+
+func (r *dnsExchangeResolver) LookupSRV(ctx context.Context, name string) ([]dnsRecord, time.Duration, error) {
+	answers, err := r.query(ctx, name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	var result []dnsRecord
+	var ttl time.Duration
+	for _, answer := range answers {
+		if srv, ok := answer.Body.(*dnsmessage.SRVResource); ok {
+			result = append(result, dnsRecord{
+				host:     strings.TrimSuffix(srv.Target.String(), "."),
+				port:     int(srv.Port),
+				weight:   int(srv.Weight),
+				priority: int(srv.Priority),
+			})
+			ttl = minTTL(ttl, answer.Header.TTL)
+		}
+	}
+	return result, ttl, nil
+}
+func (r *dnsExchangeResolver) LookupIP(ctx context.Context, name string) ([]string, time.Duration, error) {
+	var result []string
+	var ttl time.Duration
+	var errs []error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := r.query(ctx, name, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, answer := range answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				result = append(result, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				result = append(result, "["+net.IP(body.AAAA[:]).String()+"]")
+			default:
+				continue
+			}
+			ttl = minTTL(ttl, answer.Header.TTL)
+		}
+	}
+	if len(errs) == 2 {
+		return nil, 0, errors.Join(errs...)
+	}
+	return result, ttl, nil
+}
+
+// query sends DNS question to configured servers (in order) until one of them answers;
+// UDP is used first, truncated responses are repeated over TCP
+func (r *dnsExchangeResolver) query(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	request := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.UintN(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: qname, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	var opt dnsmessage.ResourceHeader
+	if err = opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	request.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+	packed, err := request.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, server := range r.servers {
+		response, err := r.exchange(ctx, "udp", server, packed, request.ID)
+		if err == nil && response.Truncated {
+			response, err = r.exchange(ctx, "tcp", server, packed, request.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+		switch response.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+			var result []dnsmessage.Resource
+			for _, answer := range response.Answers {
+				if answer.Header.Type == qtype {
+					result = append(result, answer)
+				}
+			}
+			return result, nil
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s", server, response.RCode))
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+func (r *dnsExchangeResolver) exchange(ctx context.Context, network, server string, request []byte, id uint16) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	var buf []byte
+	if network == "tcp" {
+		frame := binary.BigEndian.AppendUint16(make([]byte, 0, len(request)+2), uint16(len(request)))
+		if _, err = conn.Write(append(frame, request...)); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err = io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = conn.Write(request); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+
+	var response dnsmessage.Message
+	if err = response.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if response.ID != id || !response.Response {
+		return nil, fmt.Errorf("unexpected dns response")
+	}
+	return &response, nil
+}
+
+func minTTL(current time.Duration, ttl uint32) time.Duration {
+	v := time.Duration(ttl) * time.Second
+	if current == 0 || v < current {
+		return v
+	}
+	return current
+}
+
+// endregion
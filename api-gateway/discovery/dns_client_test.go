@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDnsClient(t *testing.T) {
+
+	var targets atomic.Int32
+	targets.Store(1)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	go serveTestDns(conn, &targets)
+
+	notifications := make(chan struct{})
+	client := NewDnsClient(
+		NewDnsClientConfig().
+			WithServers(conn.LocalAddr().String()).
+			WithServices("service-a=_http._tcp.service-a.internal", "service-b=https://service-b.internal:8443").
+			WithTTL(time.Millisecond*10, time.Millisecond*50),
+	)
+	assert.NoError(t, client.Connect(notifications))
+
+	waitNotification(t, notifications)
+	waitNotification(t, notifications)
+
+	remotes := client.Services().Get("service-a")
+	assert.Len(t, remotes, 1)
+	assert.Equal(t, "http://backend-1.internal:3101", remotes[0].String())
+	assert.Equal(t, 10, remotes[0].Weight)
+	remotes = client.Services().Get("service-b")
+	assert.Len(t, remotes, 1)
+	assert.Equal(t, "https://10.0.0.2:8443", remotes[0].String())
+
+	targets.Store(2)
+	waitNotification(t, notifications)
+	assert.Len(t, client.Services().Get("service-a"), 2)
+}
+
+func TestDnsQueryParse(t *testing.T) {
+	q, err := parseDnsQuery("_https._tcp.service-a.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, dnsQuery{name: "_https._tcp.service-a.internal", srv: true, scheme: "https"}, q)
+	q, err = parseDnsQuery("service-b.internal:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, dnsQuery{name: "service-b.internal", scheme: "http", port: 8080}, q)
+	_, err = parseDnsQuery("service-b.internal")
+	assert.Error(t, err)
+}
+
+func serveTestDns(conn net.PacketConn, targets *atomic.Int32) {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var request dnsmessage.Message
+		if err = request.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		question := request.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: request.ID, Response: true},
+			Questions: request.Questions,
+		}
+		header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 1}
+		switch {
+		case question.Type == dnsmessage.TypeSRV && question.Name.String() == "_http._tcp.service-a.internal.":
+			for i := 1; i <= int(targets.Load()); i++ {
+				target := dnsmessage.MustNewName("backend-" + string(rune('0'+i)) + ".internal.")
+				response.Answers = append(response.Answers, dnsmessage.Resource{
+					Header: header,
+					Body:   &dnsmessage.SRVResource{Priority: 1, Weight: 10, Port: uint16(3100 + i), Target: target},
+				})
+			}
+			// less preferred target should be ignored
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: header,
+				Body:   &dnsmessage.SRVResource{Priority: 2, Weight: 10, Port: 3199, Target: dnsmessage.MustNewName("backup.internal.")},
+			})
+		case question.Type == dnsmessage.TypeA && question.Name.String() == "service-b.internal.":
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: header,
+				Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 2}},
+			})
+		case question.Type == dnsmessage.TypeAAAA:
+		default:
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		packed, _ := response.Pack()
+		_, _ = conn.WriteTo(packed, addr)
+	}
+}
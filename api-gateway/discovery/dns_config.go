@@ -0,0 +1,138 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func NewDnsClientConfig() *dnsConfig {
+	return &dnsConfig{
+		services:      make(map[string]string),
+		timeout:       2 * time.Second,
+		minTTL:        5 * time.Second,
+		maxTTL:        5 * time.Minute,
+		retryInterval: 5 * time.Second,
+	}
+}
+
+type dnsConfig struct {
+	servers       []string          // [optional] DNS servers (host:port); nameservers from /etc/resolv.conf, if empty
+	services      map[string]string // service name -> DNS query ("_http._tcp.service-a.internal" or "[scheme://]service-a.internal:port")
+	timeout       time.Duration     // single DNS query timeout
+	minTTL        time.Duration     // min re-resolve interval (guards against zero TTL answers)
+	maxTTL        time.Duration     // max re-resolve interval
+	retryInterval time.Duration     // re-resolve interval after failed lookup
+}
+
+func (c *dnsConfig) WithServers(servers ...string) *dnsConfig {
+	for _, server := range servers {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		c.servers = append(c.servers, server)
+	}
+	return c
+}
+func (c *dnsConfig) WithService(name, query string) *dnsConfig {
+	c.services[strings.TrimSpace(name)] = strings.TrimSpace(query)
+	return c
+}
+
+// WithServices accepts service definitions in "{name}={query}" form
+func (c *dnsConfig) WithServices(definitions ...string) *dnsConfig {
+	for _, definition := range definitions {
+		if name, query, ok := strings.Cut(definition, "="); ok {
+			c.WithService(name, query)
+		} else if definition = strings.TrimSpace(definition); definition != "" {
+			c.services[definition] = "" // reported on Connect
+		}
+	}
+	return c
+}
+func (c *dnsConfig) WithTimeout(timeout time.Duration) *dnsConfig {
+	if timeout > 0 {
+		c.timeout = timeout
+	}
+	return c
+}
+func (c *dnsConfig) WithTTL(min, max time.Duration) *dnsConfig {
+	if min > 0 {
+		c.minTTL = min
+	}
+	if max > 0 {
+		c.maxTTL = max
+	}
+	return c
+}
+func (c *dnsConfig) WithRetry(interval time.Duration) *dnsConfig {
+	if interval > 0 {
+		c.retryInterval = interval
+	}
+	return c
+}
+
+func (c *dnsConfig) getServers() []string {
+	if len(c.servers) > 0 {
+		return c.servers
+	}
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return []string{"127.0.0.1:53"}
+	}
+	defer file.Close()
+	var result []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			result = append(result, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(result) == 0 {
+		return []string{"127.0.0.1:53"}
+	}
+	return result
+}
+
+// dnsQuery is a parsed service definition
+type dnsQuery struct {
+	name   string // DNS name to resolve
+	srv    bool   // SRV (true) or A/AAAA (false) lookup
+	scheme string // target scheme
+	port   int    // target port (A/AAAA lookup only)
+}
+
+func parseDnsQuery(input string) (dnsQuery, error) {
+	if input == "" {
+		return dnsQuery{}, fmt.Errorf("empty dns query")
+	}
+	if strings.HasPrefix(input, "_") {
+		// _service._proto.name
+		scheme := "http"
+		if strings.HasPrefix(input, "_https.") {
+			scheme = "https"
+		}
+		return dnsQuery{name: input, srv: true, scheme: scheme}, nil
+	}
+	scheme := "http"
+	if v, rest, ok := strings.Cut(input, "://"); ok {
+		scheme, input = v, rest
+	}
+	host, port, err := net.SplitHostPort(input)
+	if err != nil {
+		return dnsQuery{}, fmt.Errorf("port is required for A/AAAA lookup: %s", input)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 {
+		return dnsQuery{}, fmt.Errorf("invalid port %s: %s", port, input)
+	}
+	return dnsQuery{name: host, scheme: scheme, port: p}, nil
+}
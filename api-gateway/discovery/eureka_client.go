@@ -73,14 +73,25 @@ func (c *eurekaClient) Services() *Remotes {
 	for _, app := range c.applications.Applications {
 		for _, instance := range app.Instances {
 			r := Remote{
-				App:  app.Name,
-				Host: instance.IpAddr,
+				App:    app.Name,
+				Host:   instance.IpAddr,
+				Status: instance.Status,
 			}
 			if instance.Port != nil {
 				r.Port = instance.Port.Port
 			}
-			r.Scheme = "http" // TODO: parse meta to get correct scheme
-			r.Status = instance.Status
+			if instance.SecurePort != nil && instance.SecurePort.Enabled {
+				r.Scheme = "https"
+				r.Port = instance.SecurePort.Port
+			}
+			if instance.DataCenterInfo != nil && instance.DataCenterInfo.Metadata != nil {
+				r.Zone = instance.DataCenterInfo.Metadata.AvailabilityZone
+			}
+			var meta map[string]string
+			if instance.Metadata != nil {
+				meta = instance.Metadata.Map
+			}
+			r = r.WithMeta(meta) // scheme is taken from metadata unless secure port is enabled
 			c.logger.Debug("add %s: %s", instance.App, r)
 			result.Add(app.Name, r)
 		}
@@ -0,0 +1,392 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slink-go/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errK8sResourceGone = errors.New("resource version is too old")
+
+func NewK8sClient(config *k8sConfig) Client {
+	return &k8sClient{
+		config: *config,
+		logger: logging.GetLogger("k8s-client"),
+		slices: make(map[string]k8sEndpointSlice),
+		sigChn: make(chan os.Signal, 1),
+	}
+}
+
+type k8sClient struct {
+	config        k8sConfig
+	mutex         sync.RWMutex
+	client        *http.Client
+	logger        logging.Logger
+	slices        map[string]k8sEndpointSlice // namespace/name -> endpoint slice
+	synced        bool
+	sigChn        chan os.Signal
+	Notifications chan struct{}
+}
+
+func (c *k8sClient) Connect(options ...interface{}) error {
+	if c.config.url == "" {
+		return fmt.Errorf("kubernetes api url is empty")
+	}
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	c.client = client
+
+	if len(options) > 0 {
+		if chn, ok := options[0].(chan struct{}); ok {
+			c.Notifications = chn
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.run(ctx)
+	go c.handleSignal(cancel)
+	return nil
+}
+func (c *k8sClient) Services() *Remotes {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if !c.synced {
+		return nil
+	}
+
+	result := Remotes{}
+	for _, slice := range c.slices {
+		service := slice.Metadata.Labels[k8sServiceNameLabel]
+		if service == "" {
+			continue
+		}
+		port, ok := slice.port(c.config.portName)
+		if !ok {
+			c.logger.Debug("no matching port in endpoint slice %s/%s", slice.Metadata.Namespace, slice.Metadata.Name)
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if !endpoint.Conditions.isReady() {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				r := Remote{
+					App:    service,
+					Scheme: port.scheme(),
+					Host:   slice.host(address),
+					Port:   int(*port.Port),
+					Status: "UP",
+				}.WithMeta(endpoint.meta(slice.Metadata.Labels))
+				c.logger.Debug("add %s: %s", service, r)
+				result.Add(service, r)
+			}
+		}
+	}
+	return &result
+}
+func (c *k8sClient) NotificationsChn() chan struct{} {
+	return c.Notifications
+}
+
+func (c *k8sClient) run(ctx context.Context) {
+	version := ""
+	for ctx.Err() == nil {
+		var err error
+		if version == "" {
+			version, err = c.list(ctx)
+		} else {
+			version, err = c.watch(ctx, version)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, errK8sResourceGone):
+			c.logger.Debug("watch expired; re-listing endpoint slices")
+			version = ""
+		case ctx.Err() != nil:
+			return
+		default:
+			c.logger.Warning("endpoint slices watch error: %s", strings.TrimSpace(err.Error()))
+			version = ""
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.config.retryInterval):
+			}
+		}
+	}
+}
+func (c *k8sClient) list(ctx context.Context) (string, error) {
+	response, err := c.request(ctx, c.query(nil))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var list k8sEndpointSliceList
+	if err = json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("could not decode endpoint slices: %w", err)
+	}
+
+	slices := make(map[string]k8sEndpointSlice, len(list.Items))
+	for _, slice := range list.Items {
+		slices[slice.key()] = slice
+	}
+	c.mutex.Lock()
+	c.slices = slices
+	c.synced = true
+	c.mutex.Unlock()
+
+	c.logger.Trace("listed %d endpoint slices (version %s)", len(slices), list.Metadata.ResourceVersion)
+	c.notify()
+	return list.Metadata.ResourceVersion, nil
+}
+func (c *k8sClient) watch(ctx context.Context, version string) (string, error) {
+	params := url.Values{}
+	params.Set("watch", "true")
+	params.Set("allowWatchBookmarks", "true")
+	params.Set("resourceVersion", version)
+	params.Set("timeoutSeconds", strconv.Itoa(int(c.config.watchTimeout.Seconds())))
+
+	response, err := c.request(ctx, c.query(params))
+	if err != nil {
+		return version, err
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event k8sWatchEvent
+		if err = decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return version, nil // server-side watch timeout; resume from last seen version
+			}
+			return version, err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			var slice k8sEndpointSlice
+			if err = json.Unmarshal(event.Object, &slice); err != nil {
+				return version, fmt.Errorf("could not decode endpoint slice: %w", err)
+			}
+			c.mutex.Lock()
+			if event.Type == "DELETED" {
+				delete(c.slices, slice.key())
+			} else {
+				c.slices[slice.key()] = slice
+			}
+			c.mutex.Unlock()
+			c.logger.Trace("%s endpoint slice %s", strings.ToLower(event.Type), slice.key())
+			version = slice.Metadata.ResourceVersion
+			c.notify()
+		case "BOOKMARK":
+			var slice k8sEndpointSlice
+			if err = json.Unmarshal(event.Object, &slice); err == nil {
+				version = slice.Metadata.ResourceVersion
+			}
+		case "ERROR":
+			var status k8sStatus
+			_ = json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return "", errK8sResourceGone
+			}
+			return version, fmt.Errorf("watch error: %d %s", status.Code, status.Message)
+		}
+	}
+}
+func (c *k8sClient) request(ctx context.Context, target string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if token := c.config.getToken(); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return response, nil
+	case http.StatusGone:
+		response.Body.Close()
+		return nil, errK8sResourceGone
+	default:
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected response %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+func (c *k8sClient) query(params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	if c.config.labelSelector != "" {
+		params.Set("labelSelector", c.config.labelSelector)
+	}
+	if len(params) == 0 {
+		return c.config.endpointSlicesPath()
+	}
+	return c.config.endpointSlicesPath() + "?" + params.Encode()
+}
+func (c *k8sClient) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.config.insecure,
+	}
+	if !c.config.insecure && c.config.caFile != "" {
+		if pem, err := os.ReadFile(c.config.caFile); err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("could not parse kubernetes CA bundle %s", c.config.caFile)
+			}
+			tlsConfig.RootCAs = pool
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not read kubernetes CA bundle %s: %w", c.config.caFile, err)
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+func (c *k8sClient) notify() {
+	if c.Notifications != nil {
+		c.Notifications <- struct{}{}
+	}
+}
+func (c *k8sClient) handleSignal(cancel context.CancelFunc) {
+	signal.Notify(c.sigChn, syscall.SIGTERM, syscall.SIGINT)
+	<-c.sigChn
+	c.logger.Info("receive exit signal")
+	cancel()
+}
+
+// region - kubernetes api model
+
+type k8sObjectMeta struct {
+	Name            string            `json:"name,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+type k8sEndpointSliceList struct {
+	Metadata k8sObjectMeta      `json:"metadata"`
+	Items    []k8sEndpointSlice `json:"items"`
+}
+type k8sEndpointSlice struct {
+	Metadata    k8sObjectMeta     `json:"metadata"`
+	AddressType string            `json:"addressType,omitempty"`
+	Endpoints   []k8sEndpoint     `json:"endpoints,omitempty"`
+	Ports       []k8sEndpointPort `json:"ports,omitempty"`
+}
+type k8sEndpoint struct {
+	Addresses  []string              `json:"addresses,omitempty"`
+	Conditions k8sEndpointConditions `json:"conditions,omitempty"`
+	Hostname   *string               `json:"hostname,omitempty"`
+	NodeName   *string               `json:"nodeName,omitempty"`
+	Zone       *string               `json:"zone,omitempty"`
+}
+type k8sEndpointConditions struct {
+	Ready       *bool `json:"ready,omitempty"`
+	Serving     *bool `json:"serving,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+type k8sEndpointPort struct {
+	Name        *string `json:"name,omitempty"`
+	Port        *int32  `json:"port,omitempty"`
+	Protocol    *string `json:"protocol,omitempty"`
+	AppProtocol *string `json:"appProtocol,omitempty"`
+}
+type k8sWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+type k8sStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// meta collects endpoint topology data and slice labels (zone, version, weight,
+// etc. can be set using well-known keys in EndpointSlice labels)
+func (e k8sEndpoint) meta(labels map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range labels {
+		result[k] = v
+	}
+	if v, ok := labels["app.kubernetes.io/version"]; ok {
+		result[MetaVersion] = v
+	}
+	if e.Zone != nil {
+		result[MetaZone] = *e.Zone
+	}
+	if e.NodeName != nil {
+		result["node"] = *e.NodeName
+	}
+	if e.Hostname != nil {
+		result["hostname"] = *e.Hostname
+	}
+	return result
+}
+
+func (s k8sEndpointSlice) key() string {
+	return s.Metadata.Namespace + "/" + s.Metadata.Name
+}
+func (s k8sEndpointSlice) port(name string) (k8sEndpointPort, bool) {
+	for _, p := range s.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if name == "" || (p.Name != nil && *p.Name == name) {
+			return p, true
+		}
+	}
+	return k8sEndpointPort{}, false
+}
+func (s k8sEndpointSlice) host(address string) string {
+	if s.AddressType == "IPv6" {
+		return "[" + address + "]"
+	}
+	return address
+}
+
+// isReady follows the EndpointSlice API convention: nil "ready" condition should be interpreted as ready
+func (c k8sEndpointConditions) isReady() bool {
+	return c.Ready == nil || *c.Ready
+}
+
+func (p k8sEndpointPort) scheme() string {
+	if p.AppProtocol != nil && strings.EqualFold(*p.AppProtocol, "https") {
+		return "https"
+	}
+	if p.Name != nil && strings.EqualFold(*p.Name, "https") {
+		return "https"
+	}
+	if p.Port != nil && *p.Port == 443 {
+		return "https"
+	}
+	return "" // "scheme" and "secure" labels are used (see Remote.WithMeta)
+}
+
+// endregion
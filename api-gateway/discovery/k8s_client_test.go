@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const k8sTestSlice = `{
+	"metadata": {
+		"name": "service-a-abcde",
+		"namespace": "test",
+		"resourceVersion": "%s",
+		"labels": {"kubernetes.io/service-name": "service-a"}
+	},
+	"addressType": "IPv4",
+	"endpoints": [
+		{"addresses": ["10.0.0.1"], "conditions": {"ready": true}},
+		{"addresses": ["10.0.0.2"], "conditions": {"ready": %v}},
+		{"addresses": ["10.0.0.3"]}
+	],
+	"ports": [
+		{"name": "metrics", "port": 9090},
+		{"name": "http", "port": 8080}
+	]
+}`
+
+func TestK8sClient(t *testing.T) {
+
+	events := make(chan string)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/test/endpointslices" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("labelSelector") != "app=test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("watch") != "true" {
+			_, _ = fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [%s]}`, fmt.Sprintf(k8sTestSlice, "1", false))
+			return
+		}
+		assert.Equal(t, "1", r.URL.Query().Get("resourceVersion"))
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				_, _ = w.Write([]byte(event))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(events)
+
+	notifications := make(chan struct{})
+	client := NewK8sClient(
+		NewK8sClientConfig().
+			WithUrl(server.URL).
+			WithToken("test-token").
+			WithNamespace("test").
+			WithLabelSelector("app=test").
+			WithPortName("http"),
+	)
+	assert.NoError(t, client.Connect(notifications))
+	assert.Equal(t, notifications, client.NotificationsChn())
+
+	waitNotification(t, notifications)
+	remotes := client.Services().Get("service-a")
+	assert.Len(t, remotes, 2)
+	assert.Equal(t, "http://10.0.0.1:8080", remotes[0].String())
+	assert.Equal(t, "http://10.0.0.3:8080", remotes[1].String())
+
+	slice := fmt.Sprintf(k8sTestSlice, "2", true)
+	event, _ := json.Marshal(map[string]any{"type": "MODIFIED", "object": json.RawMessage(slice)})
+	events <- string(event)
+	waitNotification(t, notifications)
+	assert.Len(t, client.Services().Get("service-a"), 3)
+
+	event, _ = json.Marshal(map[string]any{"type": "DELETED", "object": json.RawMessage(slice)})
+	events <- string(event)
+	waitNotification(t, notifications)
+	assert.Empty(t, client.Services().List())
+}
+
+func waitNotification(t *testing.T, chn chan struct{}) {
+	select {
+	case <-chn:
+	case <-time.After(time.Second):
+		t.Fatal("notification timeout")
+	}
+}
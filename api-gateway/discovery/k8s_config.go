@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sServiceNameLabel  = "kubernetes.io/service-name"
+)
+
+func NewK8sClientConfig() *k8sConfig {
+	cfg := &k8sConfig{
+		tokenFile:     k8sServiceAccountDir + "/token",
+		caFile:        k8sServiceAccountDir + "/ca.crt",
+		retryInterval: 5 * time.Second,
+		watchTimeout:  5 * time.Minute,
+	}
+	// in-cluster defaults
+	if host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"); host != "" && port != "" {
+		cfg.url = "https://" + net.JoinHostPort(host, port)
+	}
+	if v, err := os.ReadFile(k8sServiceAccountDir + "/namespace"); err == nil {
+		cfg.namespace = strings.TrimSpace(string(v))
+	}
+	return cfg
+}
+
+type k8sConfig struct {
+	url           string        // kubernetes API server url
+	token         string        // [optional] static bearer token (takes precedence over token file)
+	tokenFile     string        // [optional] bearer token file (re-read on every (re)connect to support token rotation)
+	caFile        string        // [optional] API server CA bundle
+	insecure      bool          // [false] skip API server certificate verification
+	namespace     string        // [optional] namespace to watch (all namespaces, if empty)
+	labelSelector string        // [optional] EndpointSlice label selector
+	portName      string        // [optional] endpoint port name to use (first port, if empty)
+	retryInterval time.Duration // delay before reconnect after watch failure
+	watchTimeout  time.Duration // server-side watch timeout
+}
+
+func (c *k8sConfig) WithUrl(url string) *k8sConfig {
+	if url != "" {
+		c.url = strings.TrimSuffix(url, "/")
+	}
+	return c
+}
+func (c *k8sConfig) WithToken(token string) *k8sConfig {
+	c.token = token
+	return c
+}
+func (c *k8sConfig) WithTokenFile(path string) *k8sConfig {
+	if path != "" {
+		c.tokenFile = path
+	}
+	return c
+}
+func (c *k8sConfig) WithCAFile(path string) *k8sConfig {
+	if path != "" {
+		c.caFile = path
+	}
+	return c
+}
+func (c *k8sConfig) WithInsecure(insecure bool) *k8sConfig {
+	c.insecure = insecure
+	return c
+}
+func (c *k8sConfig) WithNamespace(namespace string) *k8sConfig {
+	if namespace != "" {
+		c.namespace = namespace
+	}
+	return c
+}
+func (c *k8sConfig) WithLabelSelector(selector string) *k8sConfig {
+	c.labelSelector = selector
+	return c
+}
+func (c *k8sConfig) WithPortName(name string) *k8sConfig {
+	c.portName = name
+	return c
+}
+func (c *k8sConfig) WithRetry(interval time.Duration) *k8sConfig {
+	if interval > 0 {
+		c.retryInterval = interval
+	}
+	return c
+}
+func (c *k8sConfig) WithWatchTimeout(timeout time.Duration) *k8sConfig {
+	if timeout > 0 {
+		c.watchTimeout = timeout
+	}
+	return c
+}
+
+func (c *k8sConfig) getToken() string {
+	if c.token != "" {
+		return c.token
+	}
+	if c.tokenFile == "" {
+		return ""
+	}
+	v, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(v))
+}
+func (c *k8sConfig) endpointSlicesPath() string {
+	if c.namespace == "" {
+		return fmt.Sprintf("%s/apis/discovery.k8s.io/v1/endpointslices", c.url)
+	}
+	return fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", c.url, c.namespace)
+}
@@ -2,15 +2,38 @@ package discovery
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
+// well-known instance metadata keys
+const (
+	MetaZone    = "zone"
+	MetaWeight  = "weight"
+	MetaVersion = "version"
+	MetaScheme  = "scheme"
+	MetaSecure  = "secure"
+
+	// upstream TLS settings (override gateway-wide UPSTREAM_TLS_* settings)
+	MetaTLSCA                 = "tls-ca"
+	MetaTLSCert               = "tls-cert"
+	MetaTLSKey                = "tls-key"
+	MetaTLSServerName         = "tls-server-name"
+	MetaTLSVerifyHostname     = "tls-verify-hostname"
+	MetaTLSInsecureSkipVerify = "tls-insecure-skip-verify"
+)
+
 type Remote struct {
-	App    string `json:"app,omitempty"`
-	Scheme string `json:"scheme,omitempty"`
-	Host   string `json:"host,omitempty"`
-	Port   int    `json:"port,omitempty"`
-	Status string `json:"status,omitempty"`
+	App     string            `json:"app,omitempty"`
+	Scheme  string            `json:"scheme,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Port    int               `json:"port,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Zone    string            `json:"zone,omitempty"`
+	Weight  int               `json:"weight,omitempty"` // relative load balancing weight (0 means default weight of 1)
+	Version string            `json:"version,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
 }
 
 func (r Remote) String() string {
@@ -25,6 +48,38 @@ func (r Remote) Compare(other Remote) int {
 	return strings.Compare(r.String(), other.String())
 }
 
+// WithMeta sets remote metadata and fills zone, weight, version and scheme from well-known metadata keys
+// (explicitly set remote fields are not overridden); scheme defaults to http
+func (r Remote) WithMeta(meta map[string]string) Remote {
+	if r.Meta == nil && len(meta) > 0 {
+		r.Meta = make(map[string]string, len(meta))
+	}
+	for k, v := range meta {
+		r.Meta[k] = v
+	}
+	if r.Zone == "" {
+		r.Zone = meta[MetaZone]
+	}
+	if r.Version == "" {
+		r.Version = meta[MetaVersion]
+	}
+	if r.Weight == 0 {
+		if v, err := strconv.Atoi(meta[MetaWeight]); err == nil && v > 0 {
+			r.Weight = v
+		}
+	}
+	if r.Scheme == "" {
+		if v := strings.ToLower(meta[MetaScheme]); v != "" {
+			r.Scheme = v
+		} else if v, err := strconv.ParseBool(meta[MetaSecure]); err == nil && v {
+			r.Scheme = "https"
+		} else {
+			r.Scheme = "http"
+		}
+	}
+	return r
+}
+
 type Remotes struct {
 	Data map[string][]Remote `json:"remotes,omitempty"`
 }
@@ -0,0 +1,23 @@
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRemoteWithMeta(t *testing.T) {
+	remote := Remote{Host: "a", Port: 8080}.WithMeta(nil)
+	assert.Equal(t, "http://a:8080", remote.String())
+	assert.Nil(t, remote.Meta)
+
+	remote = Remote{Host: "a", Port: 8443}.WithMeta(map[string]string{MetaSecure: "true", MetaZone: "z1", MetaWeight: "2"})
+	assert.Equal(t, "https://a:8443", remote.String())
+	assert.Equal(t, "z1", remote.Zone)
+	assert.Equal(t, 2, remote.Weight)
+
+	// explicitly set fields are not overridden (e.g. eureka secure port with "scheme" metadata)
+	remote = Remote{Scheme: "https", Host: "a", Port: 8443, Zone: "z2"}.WithMeta(map[string]string{MetaScheme: "http", MetaZone: "z1"})
+	assert.Equal(t, "https://a:8443", remote.String())
+	assert.Equal(t, "z2", remote.Zone)
+	assert.Equal(t, "z1", remote.Meta[MetaZone])
+}
@@ -1,50 +1,166 @@
 package discovery
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
 	"github.com/slink-go/api-gateway/discovery/util"
+	"github.com/slink-go/api-gateway/internal/fswatch"
 	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
 	"gopkg.in/yaml.v3"
-	"io"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Provider struct {
-	logger logging.Logger
-	config map[string][]Remote
+	logger        logging.Logger
+	mutex         sync.RWMutex
+	config        map[string][]Remote
+	path          string   // registry file path (empty for in-memory registry)
+	checksum      [32]byte // last applied registry file checksum
+	Notifications chan struct{}
 }
 
 func (c *Provider) NotificationsChn() chan struct{} {
-	return nil
+	return c.Notifications
 }
 
 func LoadFromFile(path string) (Client, error) {
-
-	type registryConfigRecord struct {
-		Name      string   `json:"name,omitempty",yaml:"name,omitempty"`
-		Instances []string `json:"instances,omitempty",yaml:"instances,omitempty"`
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-
-	file, err := os.Open(path)
+	config, err := parseRegistry(path, data)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return &Provider{
+		logger:   logging.GetLogger("static-client"),
+		config:   config,
+		path:     path,
+		checksum: sha256.Sum256(data),
+	}, nil
+}
+func NewStaticClient(services map[string][]Remote) Client {
+	return &Provider{
+		logger: logging.GetLogger("static-client"),
+		config: services,
+	}
+}
+
+// Connect starts registry file watching, if notifications channel is passed in options;
+// on file change registry is re-read and validated, broken configuration is rejected
+func (c *Provider) Connect(options ...interface{}) error {
+	if len(options) == 0 || c.path == "" {
+		return nil
+	}
+	chn, ok := options[0].(chan struct{})
+	if !ok {
+		return nil
+	}
+	c.Notifications = chn
+	// parent directory is watched; unchanged file content is skipped on reload
+	if err := fswatch.WatchDirs([]string{filepath.Dir(c.path)}, c.logger, c.reload); err != nil {
+		interval := env.DurationOrDefault(variables.StaticRegistryPollInterval, 5*time.Second)
+		c.logger.Warning("could not watch %s (%s); fall back to polling every %s", c.path, err, interval)
+		go c.poll(interval)
+	}
+	return nil
+}
+func (c *Provider) Services() *Remotes {
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	bytes, err := io.ReadAll(file)
+	if c.config == nil {
+		return nil
+	}
+
+	result := Remotes{}
+	for app, remotes := range c.config {
+		for _, instance := range remotes {
+			r := instance
+			r.App = strings.ToUpper(app)
+			c.logger.Debug("add %s: %s", instance.App, r)
+			result.Add(app, r)
+		}
+	}
+
+	return &result
+
+}
+
+func (c *Provider) reload() {
+	data, err := os.ReadFile(c.path)
 	if err != nil {
-		return nil, err
+		c.logger.Error("could not read %s: %s; keep current registry", c.path, err)
+		return
+	}
+	checksum := sha256.Sum256(data)
+	c.mutex.RLock()
+	unchanged := checksum == c.checksum
+	c.mutex.RUnlock()
+	if unchanged {
+		return
+	}
+	config, err := parseRegistry(c.path, data)
+	if err != nil {
+		c.logger.Error("rejected %s: %s; keep current registry", c.path, err)
+		return
+	}
+	c.mutex.Lock()
+	c.config = config
+	c.checksum = checksum
+	c.mutex.Unlock()
+	c.logger.Info("reloaded %s", c.path)
+	if c.Notifications != nil {
+		c.Notifications <- struct{}{}
+	}
+}
+func (c *Provider) poll(interval time.Duration) {
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(c.path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+	for {
+		time.Sleep(interval)
+		info, err := os.Stat(c.path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(modTime) && info.Size() == size {
+			continue
+		}
+		modTime, size = info.ModTime(), info.Size()
+		c.reload()
+	}
+}
+
+func parseRegistry(path string, data []byte) (map[string][]Remote, error) {
+
+	type registryConfigRecord struct {
+		Name      string             `json:"name,omitempty" yaml:"name,omitempty"`
+		TLS       *registryTLS       `json:"tls,omitempty" yaml:"tls,omitempty"`
+		Instances []registryInstance `json:"instances,omitempty" yaml:"instances,omitempty"`
 	}
 
 	var cfg []registryConfigRecord
+	var err error
 	if strings.HasSuffix(path, "yml") || strings.HasSuffix(path, "yaml") {
 		// read yaml
-		err = yaml.Unmarshal(bytes, &cfg)
+		err = yaml.Unmarshal(data, &cfg)
 	} else if strings.HasSuffix(path, "json") {
 		// read json
-		err = json.Unmarshal(bytes, &cfg)
+		err = json.Unmarshal(data, &cfg)
 	} else {
 		err = fmt.Errorf("unsupported file type: %s", path)
 	}
@@ -53,52 +169,136 @@ func LoadFromFile(path string) (Client, error) {
 	}
 
 	result := Remotes{}
-	for _, service := range cfg {
+	for i, service := range cfg {
+		if strings.TrimSpace(service.Name) == "" {
+			return nil, fmt.Errorf("service #%d: name is empty", i+1)
+		}
 		for _, instance := range service.Instances {
-			s, h, p := util.ParseEndpoint(instance)
+			if err = validateEndpoint(instance.Url); err != nil {
+				return nil, fmt.Errorf("service %s: %w", service.Name, err)
+			}
+			if instance.Weight < 0 {
+				return nil, fmt.Errorf("service %s: invalid instance '%s': negative weight", service.Name, instance.Url)
+			}
+			s, h, p := util.ParseEndpoint(instance.Url)
+			scheme := s
+			if !strings.Contains(instance.Url, "://") {
+				scheme = "" // taken from metadata (see Remote.WithMeta)
+			}
+			meta := service.TLS.meta(filepath.Dir(path))
+			maps.Copy(meta, instance.TLS.meta(filepath.Dir(path)))
+			maps.Copy(meta, instance.Meta)
 			result.Add(service.Name, Remote{
-				App:    service.Name,
-				Scheme: s,
-				Host:   h,
-				Port:   p,
-				Status: "UP",
-			})
+				App:     service.Name,
+				Scheme:  scheme,
+				Host:    h,
+				Port:    defaultPort(s, p),
+				Status:  "UP",
+				Zone:    instance.Zone,
+				Weight:  instance.Weight,
+				Version: instance.Version,
+				Tags:    instance.Tags,
+			}.WithMeta(meta))
 		}
 	}
-	return NewStaticClient(result.All()), nil
-}
-func NewStaticClient(services map[string][]Remote) Client {
-	return &Provider{
-		logger: logging.GetLogger("static-client"),
-		config: services,
+	if result.Data == nil {
+		return map[string][]Remote{}, nil
 	}
+	return result.All(), nil
 }
 
-func (c *Provider) Connect(options ...interface{}) error {
-	return nil
+// registryInstance is either a plain instance url string or an object with url and instance attributes
+type registryInstance struct {
+	Url     string            `json:"url" yaml:"url"`
+	Zone    string            `json:"zone,omitempty" yaml:"zone,omitempty"`
+	Weight  int               `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Version string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Tags    []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+	TLS     *registryTLS      `json:"tls,omitempty" yaml:"tls,omitempty"`
 }
-func (c *Provider) Services() *Remotes {
 
-	if c.config == nil {
+func (i *registryInstance) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*i = registryInstance{Url: value}
+		return nil
+	}
+	type plain registryInstance
+	return json.Unmarshal(data, (*plain)(i))
+}
+func (i *registryInstance) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*i = registryInstance{Url: node.Value}
 		return nil
 	}
+	type plain registryInstance
+	return node.Decode((*plain)(i))
+}
 
-	result := Remotes{}
-	for app, remotes := range c.config {
-		for _, instance := range remotes {
-			r := Remote{
-				App:    strings.ToUpper(app),
-				Scheme: instance.Scheme,
-				Host:   instance.Host,
-				Port:   instance.Port,
-				Status: "UP",
-			}
-			r.Status = instance.Status
-			c.logger.Debug("add %s: %s", instance.App, r)
-			result.Add(app, r)
+// registryTLS is upstream TLS settings of service or instance (instance settings take precedence)
+type registryTLS struct {
+	CA                 string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty" yaml:"cert,omitempty"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`
+	ServerName         string `json:"server-name,omitempty" yaml:"server-name,omitempty"`
+	VerifyHostname     *bool  `json:"verify-hostname,omitempty" yaml:"verify-hostname,omitempty"`
+	InsecureSkipVerify *bool  `json:"insecure-skip-verify,omitempty" yaml:"insecure-skip-verify,omitempty"`
+}
+
+// meta converts TLS settings to instance metadata; relative file paths are resolved against registry file directory
+func (t *registryTLS) meta(dir string) map[string]string {
+	result := make(map[string]string)
+	if t == nil {
+		return result
+	}
+	file := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if !filepath.IsAbs(value) {
+			value = filepath.Join(dir, value)
 		}
+		result[key] = value
 	}
+	file(MetaTLSCA, t.CA)
+	file(MetaTLSCert, t.Cert)
+	file(MetaTLSKey, t.Key)
+	if t.ServerName != "" {
+		result[MetaTLSServerName] = t.ServerName
+	}
+	if t.VerifyHostname != nil {
+		result[MetaTLSVerifyHostname] = strconv.FormatBool(*t.VerifyHostname)
+	}
+	if t.InsecureSkipVerify != nil {
+		result[MetaTLSInsecureSkipVerify] = strconv.FormatBool(*t.InsecureSkipVerify)
+	}
+	return result
+}
 
-	return &result
-
+func validateEndpoint(input string) error {
+	value := input
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid instance '%s': %w", input, err)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid instance '%s': empty host", input)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("invalid instance '%s': path is not supported", input)
+	}
+	return nil
+}
+func defaultPort(scheme string, port int) int {
+	if port != 0 {
+		return port
+	}
+	if scheme == "https" {
+		return 443
+	}
+	return 80
 }
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticClientReload(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	assert.NoError(t, os.WriteFile(path, []byte("- name: service-a\n  instances:\n    - http://backend:3101\n"), 0644))
+
+	client, err := LoadFromFile(path)
+	assert.NoError(t, err)
+	notifications := make(chan struct{})
+	assert.NoError(t, client.Connect(notifications))
+	assert.Len(t, client.Services().Get("service-a"), 1)
+
+	// valid change is applied
+	assert.NoError(t, os.WriteFile(path, []byte("- name: service-a\n  instances:\n    - http://backend:3101\n    - backend:3102\n"), 0644))
+	waitNotification(t, notifications)
+	assert.Len(t, client.Services().Get("service-a"), 2)
+
+	// broken change is rejected, last good config stays active
+	assert.NoError(t, os.WriteFile(path, []byte("- name: service-a\n  instances:\n    - http://backend:31o1\n"), 0644))
+	select {
+	case <-notifications:
+		t.Fatal("broken registry applied")
+	case <-time.After(300 * time.Millisecond):
+	}
+	assert.Len(t, client.Services().Get("service-a"), 2)
+
+	// atomic replace (rename) is detected
+	tmp := path + ".tmp"
+	assert.NoError(t, os.WriteFile(tmp, []byte("- name: service-b\n  instances:\n    - https://backend\n"), 0644))
+	assert.NoError(t, os.Rename(tmp, path))
+	waitNotification(t, notifications)
+	assert.Empty(t, client.Services().Get("service-a"))
+	assert.Equal(t, "https://backend", client.Services().Get("service-b")[0].String())
+}
+
+func TestStaticClientInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"name": "", "instances": ["backend:3101"]}]`), 0644))
+	_, err := LoadFromFile(path)
+	assert.Error(t, err)
+}
+
+func TestStaticClientExtendedFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	yml := filepath.Join(dir, "registry.yml")
+	assert.NoError(t, os.WriteFile(yml, []byte(`
+- name: service-a
+  instances:
+    - http://backend:3101
+    - url: backend:3102
+      zone: eu-1
+      weight: 3
+      version: 1.2.0
+      tags: [canary]
+      meta:
+        secure: "true"
+        owner: team-a
+`), 0644))
+	client, err := LoadFromFile(yml)
+	assert.NoError(t, err)
+	remotes := client.Services().Get("service-a")
+	assert.Len(t, remotes, 2)
+	extended := remotes[1]
+	assert.Equal(t, "https://backend:3102", extended.String())
+	assert.Equal(t, "eu-1", extended.Zone)
+	assert.Equal(t, 3, extended.Weight)
+	assert.Equal(t, "1.2.0", extended.Version)
+	assert.Equal(t, []string{"canary"}, extended.Tags)
+	assert.Equal(t, "team-a", extended.Meta["owner"])
+
+	json := filepath.Join(dir, "registry.json")
+	assert.NoError(t, os.WriteFile(json, []byte(`[{"name": "service-a", "instances": ["backend:3101", {"url": "backend:3102", "zone": "eu-1", "meta": {"version": "2.0"}}]}]`), 0644))
+	client, err = LoadFromFile(json)
+	assert.NoError(t, err)
+	remotes = client.Services().Get("service-a")
+	assert.Len(t, remotes, 2)
+	assert.Equal(t, "eu-1", remotes[1].Zone)
+	assert.Equal(t, "2.0", remotes[1].Version)
+
+	assert.NoError(t, os.WriteFile(json, []byte(`[{"name": "service-a", "instances": [{"url": "backend:3102", "weight": -1}]}]`), 0644))
+	_, err = LoadFromFile(json)
+	assert.Error(t, err)
+}
+
+func TestStaticClientTLS(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "registry.yml")
+	assert.NoError(t, os.WriteFile(yml, []byte(`
+- name: service-a
+  tls:
+    ca: certs/ca.pem
+    server-name: service-a.internal
+  instances:
+    - https://backend:3101
+    - url: https://backend:3102
+      tls:
+        cert: /etc/certs/client.crt
+        key: /etc/certs/client.key
+        verify-hostname: false
+      meta:
+        tls-server-name: backend-2.internal
+`), 0644))
+	client, err := LoadFromFile(yml)
+	assert.NoError(t, err)
+	remotes := client.Services().Get("service-a")
+	assert.Len(t, remotes, 2)
+	assert.Equal(t, map[string]string{
+		MetaTLSCA:         filepath.Join(dir, "certs/ca.pem"),
+		MetaTLSServerName: "service-a.internal",
+	}, remotes[0].Meta)
+	assert.Equal(t, map[string]string{
+		MetaTLSCA:             filepath.Join(dir, "certs/ca.pem"),
+		MetaTLSCert:           "/etc/certs/client.crt",
+		MetaTLSKey:            "/etc/certs/client.key",
+		MetaTLSServerName:     "backend-2.internal",
+		MetaTLSVerifyHostname: "false",
+	}, remotes[1].Meta)
+}
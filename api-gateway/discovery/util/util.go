@@ -40,7 +40,7 @@ func ParseEndpoint(input string) (string, string, int) {
 		scheme = "grpc"
 		host, port = doParseEndpoint(input, "grpc://")
 	default:
-		host, port = doParseEndpoint(input, "http://")
+		host, port = doParseEndpoint(input, "")
 	}
 	return scheme, host, port
 }
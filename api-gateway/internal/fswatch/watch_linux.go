@@ -0,0 +1,73 @@
+//go:build linux
+
+package fswatch
+
+import (
+	"github.com/slink-go/logging"
+	"syscall"
+	"time"
+)
+
+// debounceDelay merges change bursts (e.g. atomic replacement of several files) into single callback
+const debounceDelay = 100 * time.Millisecond
+
+// WatchDirs calls onChange when files in directories are changed; directories are watched (not
+// files) to survive editors' and kubernetes configmap/secret atomic "..data" symlink replacement
+func WatchDirs(dirs []string, logger logging.Logger, onChange func()) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	mask := uint32(syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY)
+	for _, dir := range dirs {
+		if _, err = syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+			_ = syscall.Close(fd)
+			return err
+		}
+	}
+	events := make(chan struct{}, 1)
+	go readEvents(fd, events, logger)
+	go debounce(events, debounceDelay, onChange)
+	return nil
+}
+
+func readEvents(fd int, events chan struct{}, logger logging.Logger) {
+	defer syscall.Close(fd)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n < syscall.SizeofInotifyEvent {
+			logger.Warning("file watch stopped: %v", err)
+			close(events)
+			return
+		}
+		// any change in the directories triggers (debounced) callback
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func debounce(events chan struct{}, delay time.Duration, action func()) {
+	for range events {
+		timer := time.NewTimer(delay)
+	wait:
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					break wait
+				}
+				timer.Reset(delay)
+			case <-timer.C:
+				break wait
+			}
+		}
+		timer.Stop()
+		action()
+	}
+}
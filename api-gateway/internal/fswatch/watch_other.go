@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fswatch
+
+import (
+	"errors"
+	"github.com/slink-go/logging"
+)
+
+// WatchDirs is not supported on this platform; callers should poll instead
+func WatchDirs(dirs []string, logger logging.Logger, onChange func()) error {
+	return errors.New("file system notifications are not supported")
+}
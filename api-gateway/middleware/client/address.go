@@ -0,0 +1,203 @@
+package client
+
+import (
+	"fmt"
+	"github.com/slink-go/logging"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Source is where client address is taken from
+type Source string
+
+const (
+	SourceForwardedFor Source = "xff"       // rightmost untrusted X-Forwarded-For address
+	SourceRealIp       Source = "x-real-ip" // X-Real-Ip header set by trusted proxy
+	SourceForwarded    Source = "forwarded" // rightmost untrusted RFC 7239 Forwarded "for" address
+	SourceRemote       Source = "remote"    // address of the connection peer, headers are ignored
+)
+
+func ParseSource(value string) (Source, error) {
+	switch source := Source(strings.ToLower(strings.TrimSpace(value))); source {
+	case SourceForwardedFor, SourceRealIp, SourceForwarded, SourceRemote:
+		return source, nil
+	case "":
+		return SourceForwardedFor, nil
+	default:
+		return "", fmt.Errorf("unknown client address source '%s'", value)
+	}
+}
+
+// AddressResolver finds real client address of the request (see Envoy's "use_remote_address" and
+// "xff_num_trusted_hops"). Address chain (header addresses followed by connection peer address)
+// is walked from the right; addresses of trusted proxies are skipped, and the first untrusted one
+// is the client address. Without trusted proxies, connection peer address is used.
+type AddressResolver struct {
+	source  Source
+	trusted []netip.Prefix
+	hops    int // number of proxies (in front of gateway) trusted regardless of their address
+	logger  logging.Logger
+}
+
+func NewAddressResolver(options ...Option) *AddressResolver {
+	r := AddressResolver{
+		source: SourceForwardedFor,
+		logger: logging.GetLogger("client-address"),
+	}
+	for _, option := range options {
+		option.apply(&r)
+	}
+	return &r
+}
+
+// region - options
+
+type Option interface {
+	apply(*AddressResolver)
+}
+
+type sourceOption struct {
+	value Source
+}
+
+func (o *sourceOption) apply(r *AddressResolver) {
+	r.source = o.value
+}
+func WithSource(value Source) Option {
+	return &sourceOption{value}
+}
+
+type trustedProxiesOption struct {
+	value []netip.Prefix
+}
+
+func (o *trustedProxiesOption) apply(r *AddressResolver) {
+	r.trusted = append(r.trusted, o.value...)
+}
+
+// WithTrustedProxies sets trusted proxies networks (CIDRs or plain addresses)
+func WithTrustedProxies(values ...string) (Option, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s'", value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return &trustedProxiesOption{prefixes}, nil
+}
+
+type trustedHopsOption struct {
+	value int
+}
+
+func (o *trustedHopsOption) apply(r *AddressResolver) {
+	r.hops = max(o.value, 0)
+}
+func WithTrustedHops(value int) Option {
+	return &trustedHopsOption{value}
+}
+
+// endregion
+
+func (r *AddressResolver) Source() Source {
+	return r.source
+}
+
+// Resolve returns client IP address of the request
+func (r *AddressResolver) Resolve(request *http.Request) string {
+	remote, ok := parseAddr(request.RemoteAddr)
+	if !ok {
+		// not a network connection (e.g. test request)
+		return request.RemoteAddr
+	}
+	var chain []string
+	switch r.source {
+	case SourceForwardedFor:
+		chain = headerList(request.Header.Values("X-Forwarded-For"))
+	case SourceRealIp:
+		if value := strings.TrimSpace(request.Header.Get("X-Real-Ip")); value != "" {
+			chain = []string{value}
+		}
+	case SourceForwarded:
+		chain = forwardedFor(request.Header.Values("Forwarded"))
+	}
+	client := remote
+	for i := len(chain) - 1; i >= 0 && r.trustedHop(client, len(chain)-1-i); i-- {
+		addr, ok := parseAddr(chain[i])
+		if !ok {
+			// malformed (or obfuscated) address: nearest trusted proxy is the last known hop
+			r.logger.Trace("invalid address '%s' in %s chain", chain[i], r.source)
+			break
+		}
+		client = addr
+	}
+	return client.String()
+}
+
+// TrustedPeer checks if connection peer of the request is trusted proxy
+func (r *AddressResolver) TrustedPeer(request *http.Request) bool {
+	remote, ok := parseAddr(request.RemoteAddr)
+	return ok && r.trustedHop(remote, 0)
+}
+
+// trustedHop checks if the hop which passed the request to the next one (to gateway for hop 0) is trusted
+func (r *AddressResolver) trustedHop(addr netip.Addr, hop int) bool {
+	if hop < r.hops {
+		return true
+	}
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerList(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			result = append(result, strings.TrimSpace(item))
+		}
+	}
+	return result
+}
+
+// forwardedFor extracts "for" parameters of Forwarded header elements
+func forwardedFor(values []string) []string {
+	var result []string
+	for _, element := range headerList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(name, "for") {
+				result = append(result, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return result
+}
+
+// parseAddr parses IP address with optional port ("1.2.3.4", "1.2.3.4:80", "::1", "[::1]:80")
+func parseAddr(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddressResolver(t *testing.T) {
+	trusted, err := WithTrustedProxies("10.0.0.0/8", "192.168.1.1", "fd00::/8")
+	assert.NoError(t, err)
+	tests := []struct {
+		name     string
+		source   Source
+		options  []Option
+		remote   string
+		headers  map[string]string
+		expected string
+	}{
+		{"no trusted proxies", SourceForwardedFor, nil, "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.7"},
+		{"untrusted peer", SourceForwardedFor, []Option{trusted}, "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.7"},
+		{"trusted peer", SourceForwardedFor, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		{"spoofed chain", SourceForwardedFor, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Forwarded-For": "6.6.6.6, 2.2.2.2, 192.168.1.1"}, "2.2.2.2"},
+		{"all trusted", SourceForwardedFor, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Forwarded-For": "10.0.0.1, 10.0.0.2"}, "10.0.0.1"},
+		{"no header", SourceForwardedFor, []Option{trusted}, "10.1.2.3:4000", nil, "10.1.2.3"},
+		{"malformed address", SourceForwardedFor, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Forwarded-For": "1.1.1.1, garbage, 10.0.0.5"}, "10.0.0.5"},
+		{"trusted hops", SourceForwardedFor, []Option{WithTrustedHops(2)}, "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.1.1.1, 198.51.100.1"}, "1.1.1.1"},
+		{"trusted hops, short chain", SourceForwardedFor, []Option{WithTrustedHops(3)}, "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		{"ipv6", SourceForwardedFor, []Option{trusted}, "[fd00::1]:4000", map[string]string{"X-Forwarded-For": "2001:db8::1"}, "2001:db8::1"},
+		{"ipv4-mapped peer", SourceForwardedFor, []Option{trusted}, "[::ffff:10.1.2.3]:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		{"real ip", SourceRealIp, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Real-Ip": "1.1.1.1"}, "1.1.1.1"},
+		{"real ip, untrusted peer", SourceRealIp, []Option{trusted}, "203.0.113.7:4000", map[string]string{"X-Real-Ip": "1.1.1.1"}, "203.0.113.7"},
+		{"forwarded", SourceForwarded, []Option{trusted}, "10.1.2.3:4000", map[string]string{"Forwarded": `for=6.6.6.6, for="[2001:db8::1]:4711";proto=https, for=192.168.1.1`}, "2001:db8::1"},
+		{"forwarded, obfuscated", SourceForwarded, []Option{trusted}, "10.1.2.3:4000", map[string]string{"Forwarded": "for=_hidden"}, "10.1.2.3"},
+		{"remote", SourceRemote, []Option{trusted}, "10.1.2.3:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				request.Header.Set(k, v)
+			}
+			resolver := NewAddressResolver(append(tt.options, WithSource(tt.source))...)
+			assert.Equal(t, tt.expected, resolver.Resolve(request))
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	source, err := ParseSource("")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceForwardedFor, source)
+	source, err = ParseSource("X-Real-IP")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceRealIp, source)
+	_, err = ParseSource("cookie")
+	assert.Error(t, err)
+
+	_, err = WithTrustedProxies("10.0.0.0/8", " 127.0.0.1 ", "")
+	assert.NoError(t, err)
+	_, err = WithTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+}
@@ -5,6 +5,9 @@ const (
 	HdrAuthToken      = "AuthToken"
 	HdrAcceptLanguage = "Accept-Language"
 	HdrContentType    = "Content-Type"
+	HdrMirrored       = "X-Mirrored-Request"
+	HdrRequestId      = "X-Request-Id"
+	HdrRealIp         = "X-Real-Ip"
 )
 const (
 	RequestContextAuth        = "X-Request-Context-Auth"
@@ -13,9 +16,18 @@ const (
 )
 
 const (
-	CtxAuthToken   = "Ctx-Auth-Token"
-	CtxLocale      = "Ctx-Locale"
-	CtxProxyTarget = "Ctx-Proxy-Target"
-	CtxError       = "Ctx-Error"
-	CtxRateLimiter = "Ctx-Rate-Limiter"
+	CtxAuthToken     = "Ctx-Auth-Token"
+	CtxLocale        = "Ctx-Locale"
+	CtxProxyTarget   = "Ctx-Proxy-Target"
+	CtxProxyInstance = "Ctx-Proxy-Instance"
+	CtxProxyStatus   = "Ctx-Proxy-Status"
+	CtxProxyService  = "Ctx-Proxy-Service"
+	CtxProxyMirror   = "Ctx-Proxy-Mirror"
+	CtxProxyPrefix   = "Ctx-Proxy-Prefix"
+	CtxProxyResolver = "Ctx-Proxy-Resolver"
+	CtxError         = "Ctx-Error"
+	CtxRequestId     = "Ctx-Request-Id"
+	CtxClientIp      = "Ctx-Client-Ip"
+	CtxTrustedPeer   = "Ctx-Trusted-Peer"
+	CtxRateLimiter   = "Ctx-Rate-Limiter"
 )
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/util/env"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	ForwardedAppend    = "append"    // incoming forwarding headers (from trusted proxy) are extended
+	ForwardedOverwrite = "overwrite" // forwarding headers describe gateway's own client connection only
+	ForwardedStrip     = "strip"     // forwarding headers are removed
+)
+
+const (
+	hdrForwardedFor    = "X-Forwarded-For"
+	hdrForwardedProto  = "X-Forwarded-Proto"
+	hdrForwardedHost   = "X-Forwarded-Host"
+	hdrForwardedPort   = "X-Forwarded-Port"
+	hdrForwardedPrefix = "X-Forwarded-Prefix"
+	hdrForwarded       = "Forwarded"
+)
+
+var forwardingHeaders = []string{hdrForwardedFor, hdrForwardedProto, hdrForwardedHost, hdrForwardedPort, hdrForwardedPrefix, hdrForwarded, constants.HdrRealIp}
+
+// ForwardingPolicy defines forwarding headers (X-Forwarded-*, RFC 7239 Forwarded) sent to upstreams
+// and services which receive original Host header
+type ForwardingPolicy struct {
+	mode         string
+	rfc7239      bool
+	preserveHost map[string]struct{}
+}
+
+func NewForwardingPolicy() (*ForwardingPolicy, error) {
+	policy := ForwardingPolicy{
+		mode:         strings.ToLower(env.StringOrDefault(variables.ForwardedMode, ForwardedAppend)),
+		rfc7239:      env.BoolOrDefault(variables.ForwardedRfc7239, false),
+		preserveHost: make(map[string]struct{}),
+	}
+	if policy.mode != ForwardedAppend && policy.mode != ForwardedOverwrite && policy.mode != ForwardedStrip {
+		return nil, fmt.Errorf("invalid forwarded headers mode '%s'", policy.mode)
+	}
+	for _, service := range env.StringArrayOrEmpty(variables.ForwardedPreserveHost) {
+		policy.preserveHost[strings.ToUpper(strings.TrimSpace(service))] = struct{}{}
+	}
+	return &policy, nil
+}
+
+// PreserveHost checks if service receives original Host header
+func (f *ForwardingPolicy) PreserveHost(service string) bool {
+	_, ok := f.preserveHost[strings.ToUpper(service)]
+	return ok
+}
+
+// apply sets forwarding headers of upstream request (outgoing) of client request (incoming);
+// incoming forwarding headers are kept only if they are set by trusted proxy
+func (f *ForwardingPolicy) apply(ctx *gin.Context, outgoing *http.Request, incoming *http.Request) {
+	for _, header := range forwardingHeaders {
+		outgoing.Header.Del(header)
+	}
+	if f.mode == ForwardedAppend && ctx.GetBool(constants.CtxTrustedPeer) {
+		for _, header := range forwardingHeaders {
+			if values := incoming.Header.Values(header); len(values) > 0 {
+				outgoing.Header[header] = slices.Clone(values)
+			}
+		}
+	}
+	if f.mode == ForwardedStrip {
+		return
+	}
+
+	peer, _, err := net.SplitHostPort(incoming.RemoteAddr)
+	if err != nil {
+		peer = incoming.RemoteAddr
+	}
+	client := peer
+	if ip := ctx.GetString(constants.CtxClientIp); ip != "" {
+		client = ip
+	}
+	if f.mode == ForwardedOverwrite {
+		peer = client
+	}
+	proto := "http"
+	if incoming.TLS != nil {
+		proto = "https"
+	}
+	port := "80"
+	if proto == "https" {
+		port = "443"
+	}
+	if _, p, err := net.SplitHostPort(incoming.Host); err == nil {
+		port = p
+	}
+
+	// resolved client address instead of (possibly spoofed) incoming header
+	outgoing.Header.Set(constants.HdrRealIp, client)
+	appendHeader(outgoing.Header, hdrForwardedFor, peer)
+	setIfEmpty(outgoing.Header, hdrForwardedProto, proto)
+	setIfEmpty(outgoing.Header, hdrForwardedHost, incoming.Host)
+	setIfEmpty(outgoing.Header, hdrForwardedPort, port)
+	if prefix := ctx.GetString(constants.CtxProxyPrefix); prefix != "" {
+		outgoing.Header.Set(hdrForwardedPrefix, strings.TrimSuffix(outgoing.Header.Get(hdrForwardedPrefix), "/")+prefix)
+	}
+	if f.rfc7239 {
+		appendHeader(outgoing.Header, hdrForwarded, forwardedElement(peer, incoming.Host, proto))
+	}
+}
+
+func forwardedElement(peer, host, proto string) string {
+	if strings.Contains(peer, ":") {
+		// IPv6 address should be quoted
+		peer = `"[` + peer + `]"`
+	}
+	element := "for=" + peer + ";proto=" + proto
+	if host != "" {
+		element += `;host="` + host + `"`
+	}
+	return element
+}
+
+func appendHeader(header http.Header, name, value string) {
+	if prior := strings.Join(header.Values(name), ", "); prior != "" {
+		value = prior + ", " + value
+	}
+	header.Set(name, value)
+}
+
+func setIfEmpty(header http.Header, name, value string) {
+	if header.Get(name) == "" && value != "" {
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestForwardingHeaders(t *testing.T) {
+	var received *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer upstream.Close()
+	address, _ := url.Parse(upstream.URL + "/items")
+
+	incoming := http.Header{
+		"X-Forwarded-For":    {"1.1.1.1"},
+		"X-Forwarded-Proto":  {"https"},
+		"X-Forwarded-Host":   {"api.example.com"},
+		"X-Forwarded-Port":   {"443"},
+		"X-Forwarded-Prefix": {"/gw"},
+		"Forwarded":          {"for=1.1.1.1;proto=https"},
+		"X-Real-Ip":          {"2.2.2.2"},
+	}
+	forward := func(policy ForwardingPolicy, trusted bool) http.Header {
+		received = nil
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "http://gateway:8080/service-a/items", nil)
+		ctx.Request.RemoteAddr = "10.0.0.1:40000"
+		ctx.Request.Header = incoming.Clone()
+		ctx.Set(constants.CtxClientIp, "1.1.1.1")
+		ctx.Set(constants.CtxTrustedPeer, trusted)
+		ctx.Set(constants.CtxProxyService, "SERVICE-A")
+		ctx.Set(constants.CtxProxyPrefix, "/service-a")
+		CreateReverseProxy().WithForwardingPolicy(&policy).Proxy(ctx, address).ServeHTTP(httptest.NewRecorder(), ctx.Request)
+		// client request headers are intact
+		assert.Equal(t, incoming, ctx.Request.Header)
+		return received.Header
+	}
+
+	// untrusted peer: incoming headers are dropped
+	header := forward(ForwardingPolicy{mode: ForwardedAppend}, false)
+	assert.Equal(t, "10.0.0.1", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "1.1.1.1", header.Get("X-Real-Ip"))
+	assert.Equal(t, "http", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "gateway:8080", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "8080", header.Get("X-Forwarded-Port"))
+	assert.Equal(t, "/service-a", header.Get("X-Forwarded-Prefix"))
+	assert.Empty(t, header.Get("Forwarded"))
+	assert.Equal(t, address.Host, received.Host)
+
+	// trusted peer: incoming headers are extended
+	header = forward(ForwardingPolicy{mode: ForwardedAppend, rfc7239: true}, true)
+	assert.Equal(t, "1.1.1.1, 10.0.0.1", header.Get("X-Forwarded-For"))
+	assert.Equal(t, "1.1.1.1", header.Get("X-Real-Ip"))
+	assert.Equal(t, "https", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "api.example.com", header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "443", header.Get("X-Forwarded-Port"))
+	assert.Equal(t, "/gw/service-a", header.Get("X-Forwarded-Prefix"))
+	assert.Equal(t, `for=1.1.1.1;proto=https, for=10.0.0.1;proto=http;host="gateway:8080"`, header.Get("Forwarded"))
+
+	// overwrite: resolved client address only
+	header = forward(ForwardingPolicy{mode: ForwardedOverwrite, rfc7239: true}, true)
+	assert.Equal(t, []string{"1.1.1.1"}, header.Values("X-Forwarded-For"))
+	assert.Equal(t, "http", header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "/service-a", header.Get("X-Forwarded-Prefix"))
+	assert.Equal(t, `for=1.1.1.1;proto=http;host="gateway:8080"`, header.Get("Forwarded"))
+
+	// strip
+	header = forward(ForwardingPolicy{mode: ForwardedStrip, rfc7239: true}, true)
+	for _, name := range forwardingHeaders {
+		assert.Empty(t, header.Values(name), name)
+	}
+
+	// original Host header
+	forward(ForwardingPolicy{mode: ForwardedAppend, preserveHost: map[string]struct{}{"SERVICE-A": {}}}, false)
+	assert.Equal(t, "gateway:8080", received.Host)
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MirrorResultSent    = "sent"    // shadow service responded (with any status)
+	MirrorResultFailed  = "failed"  // shadow service could not be resolved or reached
+	MirrorResultSkipped = "skipped" // request body is too large, or too many mirrored requests in flight
+)
+
+var mirroredRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "void_mirrored_requests_total",
+	Help: "Number of requests mirrored to shadow services",
+}, []string{"service", "result"})
+
+// MirrorPolicy sends copies of requests to shadow services (per-service config; routes
+// can have their own mirror config); mirroring never affects primary response
+type MirrorPolicy struct {
+	services  map[string]resolver.Mirror
+	percent   float64
+	timeout   time.Duration
+	maxBody   int64
+	semaphore chan struct{} // limits mirrored requests in flight
+	client    *http.Client
+	logger    logging.Logger
+}
+
+func NewMirrorPolicy() (*MirrorPolicy, error) {
+	percent, err := strconv.ParseFloat(env.StringOrDefault(variables.MirrorPercent, "100"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid mirror percent '%s'", env.StringOrDefault(variables.MirrorPercent, ""))
+	}
+	policy := MirrorPolicy{
+		services:  make(map[string]resolver.Mirror),
+		percent:   percent,
+		timeout:   env.DurationOrDefault(variables.MirrorTimeout, time.Second*5),
+		maxBody:   env.Int64OrDefault(variables.MirrorMaxBodySize, 64*1024),
+		semaphore: make(chan struct{}, max(1, env.Int64OrDefault(variables.MirrorMaxConcurrency, 100))),
+		client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logging.GetLogger("mirror"),
+	}
+	// "{service}:{shadow service}[:{percent}],..."
+	for _, item := range env.StringArrayOrEmpty(variables.MirrorCustom) {
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid mirror config '%s'", item)
+		}
+		mirror := resolver.Mirror{Service: strings.TrimSpace(parts[1])}
+		if len(parts) == 3 {
+			if mirror.Percent, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64); err != nil || mirror.Percent < 0 || mirror.Percent > 100 {
+				return nil, fmt.Errorf("invalid mirror percent '%s'", item)
+			}
+		}
+		policy.services[strings.ToUpper(strings.TrimSpace(parts[0]))] = mirror
+	}
+	return &policy, nil
+}
+
+// Mirror asynchronously sends copy of the request being proxied to address to shadow service
+// (if mirroring is configured for request route or service)
+func (p *ReverseProxy) Mirror(ctx *gin.Context, address *url.URL) {
+	if p.mirrorPolicy == nil || p.serviceResolver == nil {
+		return
+	}
+	p.mirrorPolicy.mirror(ctx, address, p.serviceResolver, p.transports)
+}
+
+func (m *MirrorPolicy) mirror(ctx *gin.Context, address *url.URL, serviceResolver resolver.ServiceResolver, transports *TransportPool) {
+	mirror, ok := m.config(ctx)
+	if !ok || ctx.Request.Header.Get("Upgrade") != "" {
+		return
+	}
+	percent := m.percent
+	if mirror.Percent > 0 {
+		percent = mirror.Percent
+	}
+	if percent < 100 && rand.Float64()*100 >= percent {
+		return
+	}
+	timeout := m.timeout
+	if mirror.Timeout != "" {
+		timeout, _ = time.ParseDuration(mirror.Timeout) // validated on route load
+	}
+	body, ok := m.bufferBody(ctx.Request)
+	if !ok {
+		m.logger.Debug("%s: request body is too large to mirror", ctx.Request.URL)
+		mirroredRequests.WithLabelValues(mirror.Service, MirrorResultSkipped).Inc()
+		return
+	}
+	select {
+	case m.semaphore <- struct{}{}:
+	default:
+		mirroredRequests.WithLabelValues(mirror.Service, MirrorResultSkipped).Inc()
+		return
+	}
+
+	method := ctx.Request.Method
+	header := ctx.Request.Header.Clone()
+	header.Set(constants.HdrMirrored, "true")
+	go func() {
+		defer func() { <-m.semaphore }()
+		c, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := m.send(c, serviceResolver, transports, mirror.Service, method, address.RequestURI(), header, body); err != nil {
+			m.logger.Debug("mirror %s to %s: %s", address, mirror.Service, err)
+			mirroredRequests.WithLabelValues(mirror.Service, MirrorResultFailed).Inc()
+			return
+		}
+		mirroredRequests.WithLabelValues(mirror.Service, MirrorResultSent).Inc()
+	}()
+}
+
+func (m *MirrorPolicy) send(ctx context.Context, serviceResolver resolver.ServiceResolver, transports *TransportPool, service, method, uri string, header http.Header, body []byte) error {
+	instance, err := serviceResolver.Resolve(service, registry.Hint{})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, instance.String()+uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header = header
+	// shadow instance connections (and TLS settings) are shared with proxied requests
+	client := *m.client
+	client.Transport = transports.Get(instance.App, instance.Meta)
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.Body.Close()
+}
+
+// config returns mirror config for request: route mirror, or mirror of the target service
+func (m *MirrorPolicy) config(ctx *gin.Context) (resolver.Mirror, bool) {
+	if v, ok := ctx.Get(constants.CtxProxyMirror); ok {
+		if mirror, ok := v.(*resolver.Mirror); ok && mirror != nil {
+			return *mirror, true
+		}
+	}
+	mirror, ok := m.services[strings.ToUpper(ctx.GetString(constants.CtxProxyService))]
+	return mirror, ok
+}
+
+// bufferBody reads request body (up to size limit) and restores it for the primary request
+func (m *MirrorPolicy) bufferBody(request *http.Request) ([]byte, bool) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil, true
+	}
+	if request.ContentLength > m.maxBody {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, m.maxBody+1))
+	if int64(len(body)) > m.maxBody || err != nil {
+		request.Body = readCloser{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+		return nil, false
+	}
+	request.Body = readCloser{bytes.NewReader(body), request.Body}
+	return body, true
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
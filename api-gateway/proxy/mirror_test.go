@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type shadowResolver struct {
+	remote discovery.Remote
+}
+
+func (r shadowResolver) Resolve(string, registry.Hint) (*registry.Instance, error) {
+	return &registry.Instance{Remote: r.remote}, nil
+}
+
+func TestMirror(t *testing.T) {
+	type mirrored struct {
+		uri    string
+		body   string
+		marker string
+	}
+	received := make(chan mirrored, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- mirrored{r.URL.RequestURI(), string(body), r.Header.Get(constants.HdrMirrored)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+	u, _ := url.Parse(shadow.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	t.Setenv(variables.MirrorCustom, "service-a:shadow-a")
+	t.Setenv(variables.MirrorMaxBodySize, "8")
+	policy, err := NewMirrorPolicy()
+	assert.NoError(t, err)
+	p := CreateReverseProxy().
+		WithServiceResolver(shadowResolver{discovery.Remote{Scheme: "http", Host: u.Hostname(), Port: port}}).
+		WithMirrorPolicy(policy)
+	address, _ := url.Parse("http://primary:8080/items/1?a=b")
+	mirror := func(service, body string, route *resolver.Mirror) *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/api/service-a/items/1?a=b", strings.NewReader(body))
+		ctx.Set(constants.CtxProxyService, service)
+		if route != nil {
+			ctx.Set(constants.CtxProxyMirror, route)
+		}
+		p.Mirror(ctx, address)
+		// primary request body is intact
+		primary, _ := io.ReadAll(ctx.Request.Body)
+		assert.Equal(t, body, string(primary))
+		return ctx
+	}
+	sent := testutil.ToFloat64(mirroredRequests.WithLabelValues("shadow-a", MirrorResultSent))
+	skipped := testutil.ToFloat64(mirroredRequests.WithLabelValues("shadow-a", MirrorResultSkipped))
+
+	mirror("SERVICE-A", "body", nil)
+	select {
+	case r := <-received:
+		assert.Equal(t, mirrored{"/items/1?a=b", "body", "true"}, r)
+	case <-time.After(time.Second * 5):
+		t.Fatal("request is not mirrored")
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(mirroredRequests.WithLabelValues("shadow-a", MirrorResultSent)) == sent+1
+	}, time.Second, time.Millisecond*10)
+
+	// body is too large
+	mirror("SERVICE-A", "large request body", nil)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(mirroredRequests.WithLabelValues("shadow-a", MirrorResultSkipped)))
+
+	// no mirror config for service
+	mirror("SERVICE-B", "body", nil)
+
+	// route mirror with zero sampling
+	mirror("SERVICE-B", "body", &resolver.Mirror{Service: "shadow-b", Percent: 0.0001})
+	select {
+	case r := <-received:
+		t.Fatalf("unexpected mirrored request: %v", r)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ErrorBodyKeep    = "keep"    // upstream error body is forwarded as is
+	ErrorBodyReplace = "replace" // upstream error body is replaced with problem details (and logged)
+	ErrorBodyWrap    = "wrap"    // upstream error body is embedded into problem details
+)
+
+const (
+	ContentTypeProblem = "application/problem+json"
+	errorBodyLimit     = 64 * 1024
+)
+
+// Problem is RFC 7807 problem details object
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"` // request path
+	RequestId string         `json:"requestId,omitempty"`
+	Service   string         `json:"service,omitempty"`
+	Upstream  *UpstreamError `json:"upstream,omitempty"` // wrapped upstream error response
+}
+
+type UpstreamError struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        any    `json:"body,omitempty"` // JSON value, or text
+}
+
+func NewProblem(request *http.Request, status int, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  request.URL.Path,
+		RequestId: request.Header.Get(constants.HdrRequestId),
+	}
+}
+
+// ErrorProblem maps request processing error to problem details: 503 if service has no
+// available instances, 504 on upstream timeout, 502 on connection failure (and other errors)
+func ErrorProblem(request *http.Request, err error) Problem {
+	var unavailable *registry.ErrServiceUnavailable
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &unavailable):
+		problem := NewProblem(request, http.StatusServiceUnavailable, "no available instances of the service")
+		problem.Service = unavailable.Service()
+		return problem
+	case errors.Is(err, resolver.NewErrInvalidPath("")) || errors.Is(err, resolver.NewErrEmptyBaseUrl()):
+		return NewProblem(request, http.StatusBadRequest, "request path can not be resolved to service")
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return NewProblem(request, http.StatusBadGateway, "upstream service is not reachable")
+	case errors.Is(err, errPerTryTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return NewProblem(request, http.StatusGatewayTimeout, "upstream service did not respond in time")
+	default:
+		return NewProblem(request, http.StatusBadGateway, "upstream service request failed")
+	}
+}
+
+// WriteProblem writes problem details as JSON, or as HTML page if client prefers HTML
+func WriteProblem(w http.ResponseWriter, request *http.Request, problem Problem) {
+	contentType, body := problem.render(request)
+	w.Header().Set(constants.HdrContentType, contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(body)
+}
+
+var problemPage = template.Must(template.New("problem").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+{{if .Detail}}<p>{{.Detail}}</p>{{end}}
+{{if .RequestId}}<p>Request id: <code>{{.RequestId}}</code></p>{{end}}
+</body>
+</html>
+`))
+
+func (p Problem) render(request *http.Request) (string, []byte) {
+	var buf bytes.Buffer
+	if prefersHtml(request.Header.Get("Accept")) && problemPage.Execute(&buf, p) == nil {
+		return "text/html; charset=utf-8", buf.Bytes()
+	}
+	body, _ := json.Marshal(p)
+	return ContentTypeProblem, body
+}
+
+// prefersHtml checks if Accept header prefers HTML to JSON
+func prefersHtml(accept string) bool {
+	var html, json float64
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "text/html":
+			html = max(html, q)
+		case "application/json", ContentTypeProblem:
+			json = max(json, q)
+		}
+	}
+	return html > json
+}
+
+// ErrorPolicy defines how upstream error (5xx) response bodies are handled (per service)
+type ErrorPolicy struct {
+	mode     string
+	services map[string]string
+	logger   logging.Logger
+}
+
+func NewErrorPolicy() (*ErrorPolicy, error) {
+	policy := ErrorPolicy{
+		mode:     strings.ToLower(env.StringOrDefault(variables.UpstreamErrorBody, ErrorBodyReplace)),
+		services: make(map[string]string),
+		logger:   logging.GetLogger("upstream-error"),
+	}
+	if !validErrorBodyMode(policy.mode) {
+		return nil, fmt.Errorf("invalid upstream error body mode '%s'", policy.mode)
+	}
+	// "{service}:{mode},..."
+	for _, item := range env.StringArrayOrEmpty(variables.UpstreamErrorBodyCustom) {
+		service, mode, ok := strings.Cut(item, ":")
+		service = strings.ToUpper(strings.TrimSpace(service))
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if !ok || service == "" || !validErrorBodyMode(mode) {
+			return nil, fmt.Errorf("invalid upstream error body config '%s'", item)
+		}
+		policy.services[service] = mode
+	}
+	return &policy, nil
+}
+
+func validErrorBodyMode(mode string) bool {
+	return mode == ErrorBodyKeep || mode == ErrorBodyReplace || mode == ErrorBodyWrap
+}
+
+// Mode returns error body mode of the service
+func (e *ErrorPolicy) Mode(service string) string {
+	if mode, ok := e.services[strings.ToUpper(service)]; ok {
+		return mode
+	}
+	return e.mode
+}
+
+// handle applies error body mode to upstream error response of the (client) request
+func (e *ErrorPolicy) handle(request *http.Request, response *http.Response, service string) {
+	mode := e.Mode(service)
+	if mode == ErrorBodyKeep {
+		e.logger.Warning("%s %s: upstream %s responded with %d (request id: %s)",
+			request.Method, request.URL, service, response.StatusCode, request.Header.Get(constants.HdrRequestId))
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, errorBodyLimit))
+	_ = response.Body.Close()
+
+	problem := NewProblem(request, response.StatusCode, "upstream service error")
+	problem.Service = service
+	if mode == ErrorBodyWrap {
+		upstream := UpstreamError{
+			Status:      response.StatusCode,
+			ContentType: response.Header.Get(constants.HdrContentType),
+		}
+		if len(body) > 0 {
+			if mediaType, _, _ := mime.ParseMediaType(upstream.ContentType); (strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json")) && json.Valid(body) {
+				upstream.Body = json.RawMessage(body)
+			} else {
+				upstream.Body = string(body)
+			}
+		}
+		problem.Upstream = &upstream
+	}
+	e.logger.Error("%s %s: upstream %s responded with %d (request id: %s), body: %s",
+		request.Method, request.URL, service, response.StatusCode, problem.RequestId, body)
+
+	contentType, content := problem.render(request)
+	response.Header.Del("Content-Encoding")
+	response.Header.Set(constants.HdrContentType, contentType)
+	response.Header.Set("Content-Length", strconv.Itoa(len(content)))
+	response.ContentLength = int64(len(content))
+	response.Body = io.NopCloser(bytes.NewReader(content))
+}
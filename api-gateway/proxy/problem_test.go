@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/logging"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestErrorProblem(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/service-a/items", nil)
+	request.Header.Set(constants.HdrRequestId, "req-1")
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"no instances", registry.NewErrServiceUnavailable("SERVICE-A"), http.StatusServiceUnavailable},
+		{"invalid path", resolver.NewErrInvalidPath("/"), http.StatusBadRequest},
+		{"dial", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, http.StatusBadGateway},
+		{"per-try timeout", fmt.Errorf("%w: %w", errPerTryTimeout, context.Canceled), http.StatusGatewayTimeout},
+		{"deadline", fmt.Errorf("round trip: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"other", fmt.Errorf("unexpected EOF"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := ErrorProblem(request, tt.err)
+			assert.Equal(t, tt.expected, problem.Status)
+			assert.Equal(t, http.StatusText(tt.expected), problem.Title)
+			assert.Equal(t, "/service-a/items", problem.Instance)
+			assert.Equal(t, "req-1", problem.RequestId)
+		})
+	}
+	assert.Equal(t, "SERVICE-A", ErrorProblem(request, registry.NewErrServiceUnavailable("SERVICE-A")).Service)
+}
+
+func TestPrefersHtml(t *testing.T) {
+	assert.False(t, prefersHtml(""))
+	assert.False(t, prefersHtml("*/*"))
+	assert.False(t, prefersHtml("application/json"))
+	assert.True(t, prefersHtml("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"))
+	assert.True(t, prefersHtml("application/json;q=0.5, text/html"))
+	assert.False(t, prefersHtml("text/html;q=0.5, application/problem+json"))
+	assert.False(t, prefersHtml("text/html, application/json"))
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(constants.HdrContentType, "application/json")
+		w.Header().Set(constants.HdrRequestId, "upstream-id")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"db is down"}`))
+	}))
+	defer upstream.Close()
+	address, _ := url.Parse(upstream.URL + "/items")
+
+	proxyError := func(mode, accept string) *httptest.ResponseRecorder {
+		p := CreateReverseProxy().WithErrorPolicy(&ErrorPolicy{
+			mode:     ErrorBodyReplace,
+			services: map[string]string{"SERVICE-A": mode},
+			logger:   logging.GetLogger("test"),
+		})
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/service-a/items", nil)
+		ctx.Request.Header.Set(constants.HdrRequestId, "req-1")
+		ctx.Request.Header.Set("Accept", accept)
+		ctx.Set(constants.CtxProxyService, "service-a")
+		w := httptest.NewRecorder()
+		p.Proxy(ctx, address).ServeHTTP(w, ctx.Request)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Header().Get(constants.HdrRequestId)) // set by gateway
+		return w
+	}
+
+	w := proxyError(ErrorBodyKeep, "")
+	assert.Equal(t, "application/json", w.Header().Get(constants.HdrContentType))
+	assert.Equal(t, `{"error":"db is down"}`, w.Body.String())
+
+	var problem Problem
+	w = proxyError(ErrorBodyReplace, "")
+	assert.Equal(t, ContentTypeProblem, w.Header().Get(constants.HdrContentType))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusInternalServerError, problem.Status)
+	assert.Equal(t, "/service-a/items", problem.Instance)
+	assert.Equal(t, "req-1", problem.RequestId)
+	assert.Equal(t, "service-a", problem.Service)
+	assert.Nil(t, problem.Upstream)
+	assert.NotContains(t, w.Body.String(), "db is down")
+
+	w = proxyError(ErrorBodyWrap, "")
+	var wrapped struct {
+		Upstream struct {
+			Status int
+			Body   map[string]string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &wrapped))
+	assert.Equal(t, http.StatusInternalServerError, wrapped.Upstream.Status)
+	assert.Equal(t, "db is down", wrapped.Upstream.Body["error"])
+
+	w = proxyError(ErrorBodyReplace, "text/html")
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get(constants.HdrContentType))
+	assert.Contains(t, w.Body.String(), "<code>req-1</code>")
+}
+
+func TestUpstreamUnreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address, _ := url.Parse("http://" + listener.Addr().String() + "/items")
+	_ = listener.Close()
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/service-a/items", nil)
+	ctx.Request.Header.Set(constants.HdrRequestId, "req-2")
+	w := httptest.NewRecorder()
+	CreateReverseProxy().Proxy(ctx, address).ServeHTTP(w, ctx.Request)
+
+	var problem Problem
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, ContentTypeProblem, w.Header().Get(constants.HdrContentType))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "req-2", problem.RequestId)
+}
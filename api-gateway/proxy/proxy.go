@@ -1,31 +1,40 @@
 package proxy
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
 	"github.com/slink-go/api-gateway/resolver"
 	"github.com/slink-go/logging"
-	"github.com/slink-go/util/env"
-	"io"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"time"
 )
 
 type ReverseProxy struct {
 	serviceResolver resolver.ServiceResolver
 	pathProcessor   resolver.PathProcessor
+	routeTable      *resolver.RouteTable
+	virtualHosts    *resolver.VirtualHosts
+	trafficSplitter *resolver.TrafficSplitter
+	fallbacks       *resolver.Fallbacks
+	retryPolicy     *RetryPolicy
+	mirrorPolicy    *MirrorPolicy
+	transports      *TransportPool
+	errorPolicy     *ErrorPolicy
+	forwarding      *ForwardingPolicy
 	logger          logging.Logger
 }
 
 func CreateReverseProxy() *ReverseProxy {
 	return &ReverseProxy{
-		logger: logging.GetLogger("reverse-proxy"),
+		transports:  NewTransportPool(NewTransportSettings()),
+		errorPolicy: &ErrorPolicy{mode: ErrorBodyReplace, logger: logging.GetLogger("upstream-error")},
+		forwarding:  &ForwardingPolicy{mode: ForwardedAppend},
+		logger:      logging.GetLogger("reverse-proxy"),
 	}
 }
 func (p *ReverseProxy) WithServiceResolver(serviceResolver resolver.ServiceResolver) *ReverseProxy {
@@ -36,71 +45,177 @@ func (p *ReverseProxy) WithPathProcessor(pathProcessor resolver.PathProcessor) *
 	p.pathProcessor = pathProcessor
 	return p
 }
+func (p *ReverseProxy) WithRouteTable(routeTable *resolver.RouteTable) *ReverseProxy {
+	p.routeTable = routeTable
+	return p
+}
+func (p *ReverseProxy) WithVirtualHosts(virtualHosts *resolver.VirtualHosts) *ReverseProxy {
+	p.virtualHosts = virtualHosts
+	return p
+}
+func (p *ReverseProxy) WithTrafficSplitter(trafficSplitter *resolver.TrafficSplitter) *ReverseProxy {
+	p.trafficSplitter = trafficSplitter
+	return p
+}
+func (p *ReverseProxy) WithFallbacks(fallbacks *resolver.Fallbacks) *ReverseProxy {
+	p.fallbacks = fallbacks
+	return p
+}
+func (p *ReverseProxy) WithRetryPolicy(retryPolicy *RetryPolicy) *ReverseProxy {
+	p.retryPolicy = retryPolicy
+	return p
+}
+func (p *ReverseProxy) WithTransportPool(transports *TransportPool) *ReverseProxy {
+	p.transports = transports
+	return p
+}
+func (p *ReverseProxy) WithErrorPolicy(errorPolicy *ErrorPolicy) *ReverseProxy {
+	p.errorPolicy = errorPolicy
+	return p
+}
+func (p *ReverseProxy) WithForwardingPolicy(forwarding *ForwardingPolicy) *ReverseProxy {
+	p.forwarding = forwarding
+	return p
+}
+func (p *ReverseProxy) WithMirrorPolicy(mirrorPolicy *MirrorPolicy) *ReverseProxy {
+	p.mirrorPolicy = mirrorPolicy
+	return p
+}
 
-func (p *ReverseProxy) ResolveTarget(path string) (*url.URL, error) {
+// ResolveTarget resolves request to proxy target: declarative routes are evaluated first,
+// then virtual hosts; convention-based path resolution is used as a fallback. Configured
+// fallbacks are applied if request could not be resolved to available service instance
+func (p *ReverseProxy) ResolveTarget(request *http.Request, hint resolver.HintFunc) (*resolver.Target, error) {
 	if p.pathProcessor == nil {
 		panic("path processor not set")
 	}
 	if p.serviceResolver == nil {
 		panic("service resolver not set")
 	}
-	target, err := p.pathProcessor.UrlResolve(path, p.serviceResolver)
-	if err != nil {
-		return nil, err
+	serviceResolver := p.serviceResolver
+	if p.trafficSplitter != nil {
+		serviceResolver = p.trafficSplitter.Resolver(serviceResolver, request)
+	}
+	if p.fallbacks != nil {
+		serviceResolver = p.fallbacks.Resolver(serviceResolver)
 	}
-	resolved, err := url.Parse(target)
-	if err != nil {
-		return nil, err
+	target, err := p.resolveTarget(request, serviceResolver, hint)
+	if err != nil && p.fallbacks != nil {
+		target, err = p.fallbacks.TargetResolve(request, err, serviceResolver, hint)
+		target = via(target, resolver.ViaFallback)
 	}
-	return resolved, nil
+	if target != nil {
+		target.Resolver = serviceResolver
+	}
+	return target, err
+}
+func (p *ReverseProxy) resolveTarget(request *http.Request, serviceResolver resolver.ServiceResolver, hint resolver.HintFunc) (*resolver.Target, error) {
+	if p.routeTable != nil {
+		target, err := p.routeTable.TargetResolve(request, serviceResolver, hint)
+		if err != nil || target != nil {
+			return via(target, resolver.ViaRoute), err
+		}
+	}
+	if p.virtualHosts != nil {
+		target, err := p.virtualHosts.TargetResolve(request, p.pathProcessor, serviceResolver, hint)
+		if err != nil || target != nil {
+			return via(target, resolver.ViaVirtualHost), err
+		}
+	}
+	target, err := p.pathProcessor.TargetResolve(request.URL.EscapedPath(), serviceResolver, hint)
+	return via(target, resolver.ViaConvention), err
 }
 func (p *ReverseProxy) Proxy(ctx *gin.Context, address *url.URL) *httputil.ReverseProxy {
-	pr := httputil.NewSingleHostReverseProxy(address)
-	pr.Director = func(request *http.Request) {
-		request.Header = ctx.Request.Header
-		request.Host = address.Host
-		request.URL.Scheme = address.Scheme
-		request.URL.Host = address.Host
-		request.URL.Path = address.Path
-	}
-	pr.ModifyResponse = p.modifyResponseHandle(address)
+	// upstream transports are shared between requests, so connections are reused
+	instance := proxyInstance(ctx)
+	upstream := address.Host
+	if instance != nil {
+		upstream = instance.App
+	}
+	service := ctx.GetString(constants.CtxProxyService)
+	if service == "" {
+		service = upstream
+	}
+	pr := &httputil.ReverseProxy{}
+	pr.Rewrite = func(request *httputil.ProxyRequest) {
+		request.Out.Host = address.Host
+		if p.forwarding.PreserveHost(service) {
+			request.Out.Host = request.In.Host
+		}
+		request.Out.URL.Scheme = address.Scheme
+		request.Out.URL.Host = address.Host
+		request.Out.URL.Path = address.Path
+		request.Out.URL.RawPath = address.RawPath
+		request.Out.URL.RawQuery = address.RawQuery
+		p.forwarding.apply(ctx, request.Out, request.In)
+	}
+	pr.ModifyResponse = p.modifyResponseHandle(ctx.Request, service, ctx.GetInt(constants.CtxProxyStatus))
 	pr.ErrorHandler = p.errHandle
-
-	pr.Transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   env.DurationOrDefault(variables.TargetConnTimeout, 1*time.Second),
-			KeepAlive: env.DurationOrDefault(variables.TargetConnKeepAlive, 5*time.Second),
-		}).DialContext,
-		TLSHandshakeTimeout: env.DurationOrDefault(variables.TargetTLSHandshakeTimeout, 1*time.Second),
+	pr.Transport = &retryTransport{
+		transport: func(instance *registry.Instance) http.RoundTripper {
+			if instance == nil {
+				return p.transports.Get(upstream, nil)
+			}
+			return p.transports.Get(instance.App, instance.Meta)
+		},
+		policy:   p.retryPolicy,
+		resolver: proxyResolver(ctx, p.serviceResolver),
+		instance: instance,
+		logger:   p.logger,
 	}
 	return pr
 }
-func (p *ReverseProxy) modifyResponseHandle(address *url.URL) func(response *http.Response) error {
+func (p *ReverseProxy) modifyResponseHandle(request *http.Request, service string, status int) func(response *http.Response) error {
 	return func(response *http.Response) error {
-		if response.StatusCode == http.StatusInternalServerError {
-			u, s := readBody(response)
-			p.logger.Error("%s ,req %s ,with error %d, body:%s", u.String(), address, response.StatusCode, s)
-			response.Body = io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf("%s", u.String()))))
-		} else if response.StatusCode > 300 {
-			_, s := readBody(response)
-			p.logger.Error("req %s ,with error %d, body:%s", address, response.StatusCode, s)
-			response.Body = io.NopCloser(bytes.NewReader([]byte(s)))
+		// request id is set by gateway
+		response.Header.Del(constants.HdrRequestId)
+		if response.StatusCode >= http.StatusInternalServerError {
+			p.errorPolicy.handle(request, response, service)
+		} else if response.StatusCode >= http.StatusBadRequest {
+			p.logger.Debug("%s %s: upstream %s responded with %d", request.Method, request.URL, service, response.StatusCode)
+		}
+		if status != 0 {
+			// route status override
+			response.StatusCode = status
+			response.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
 		}
 		return nil
 	}
 }
 func (p *ReverseProxy) errHandle(res http.ResponseWriter, req *http.Request, err error) {
-	fmt.Println(err)
+	if errors.Is(req.Context().Err(), context.Canceled) {
+		// client has gone; not an upstream failure
+		p.logger.Debug("%s: %s", req.URL, err)
+		return
+	}
+	problem := ErrorProblem(req, err)
+	p.logger.Warning("%s %s: %s (request id: %s)", req.Method, req.URL, err, problem.RequestId)
+	WriteProblem(res, req, problem)
+}
+
+func via(target *resolver.Target, source string) *resolver.Target {
+	if target != nil {
+		target.Via = source
+	}
+	return target
+}
+
+// proxyResolver returns request service resolver (set by target resolution), so retries
+// keep traffic split backend and use fallbacks
+func proxyResolver(ctx *gin.Context, defaultResolver resolver.ServiceResolver) resolver.ServiceResolver {
+	if value, ok := ctx.Get(constants.CtxProxyResolver); ok {
+		if serviceResolver, ok := value.(resolver.ServiceResolver); ok {
+			return serviceResolver
+		}
+	}
+	return defaultResolver
 }
 
-func readBody(response *http.Response) (uuid.UUID, string) {
-	defer response.Body.Close()
-	all, _ := io.ReadAll(response.Body)
-	u := uuid.New()
-	var s string
-	if len(all) > 0 {
-		s = string(all)
-	}
-	return u, s
+func proxyInstance(ctx *gin.Context) *registry.Instance {
+	value, ok := ctx.Get(constants.CtxProxyInstance)
+	if !ok {
+		return nil
+	}
+	instance, _ := value.(*registry.Instance)
+	return instance
 }
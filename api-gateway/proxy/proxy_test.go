@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestProxyUrlForwarding(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.RequestURI
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	routes, err := resolver.NewRouteTable(resolver.Route{
+		Id:         "legacy",
+		Uri:        "lb://SERVICE-A",
+		Predicates: resolver.RoutePredicates{Path: []string{"/legacy/{name}/**"}},
+		Filters: []resolver.RouteFilter{
+			{StripPrefix: 1},
+			{AddRequestHeader: &resolver.HeaderValue{Name: "X-Name", Value: "{name}"}},
+		},
+	})
+	assert.NoError(t, err)
+	p := CreateReverseProxy().
+		WithServiceResolver(shadowResolver{discovery.Remote{Scheme: "http", Host: u.Hostname(), Port: port}}).
+		WithPathProcessor(resolver.NewPathProcessor(resolver.WithPreserveCase(true))).
+		WithRouteTable(routes)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"encoded slash", "/api/service-a/a%2Fb/c", "/api/a%2Fb/c"},
+		{"encoded space and non-ascii", "/service-a/c%20d/%D0%BF%D1%83%D1%82%D1%8C", "/c%20d/%D0%BF%D1%83%D1%82%D1%8C"},
+		{"unnecessary escaping", "/service-a/%41%42c", "/%41%42c"},
+		{"case and trailing slash", "/service-a/Items/ABC/", "/Items/ABC/"},
+		{"double slash", "/service-a/a//b", "/a//b"},
+		{"query order and repeats", "/service-a/items?b=2&a=1&a=0", "/items?b=2&a=1&a=0"},
+		{"query special characters", "/service-a/items?q=a%26b%3Dc&p=%2B+x&e=a=b", "/items?q=a%26b%3Dc&p=%2B+x&e=a=b"},
+		{"query non-ascii", "/service-a/items?q=%D0%B4%D0%B0&empty&=v", "/items?q=%D0%B4%D0%B0&empty&=v"},
+		{"route", "/legacy/a%2Fb/x%2Fy?z=1", "/a%2Fb/x%2Fy?z=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodGet, tt.input, nil)
+			target, err := p.ResolveTarget(ctx.Request, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			// see gateway proxy handler
+			address, err := url.Parse(target.Url)
+			assert.NoError(t, err)
+			address.RawQuery = ctx.Request.URL.RawQuery
+			p.Proxy(ctx, address).ServeHTTP(httptest.NewRecorder(), ctx.Request)
+			assert.Equal(t, tt.expected, received)
+		})
+	}
+}
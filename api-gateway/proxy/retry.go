@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	retryBodyLimit    = 1 << 20 // max request body size buffered for retries
+	retryBudgetWindow = 10      // retry budget window, seconds
+)
+
+var errPerTryTimeout = errors.New("per-try timeout exceeded")
+
+// RetryPolicy describes how failed upstream calls are retried on another service instance
+type RetryPolicy struct {
+	maxAttempts   int
+	perTryTimeout time.Duration // time to wait for upstream response headers; 0 - no limit
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	statuses      []int               // response statuses to retry on (connection failures are always retried)
+	nonIdempotent map[string]struct{} // services which allow retries for non-idempotent methods
+	budget        *retryBudget
+}
+
+func NewRetryPolicy() (*RetryPolicy, error) {
+	ratio, err := strconv.ParseFloat(env.StringOrDefault(variables.RetryBudgetRatio, "0.2"), 64)
+	if err != nil || ratio < 0 {
+		return nil, fmt.Errorf("invalid retry budget ratio '%s'", env.StringOrDefault(variables.RetryBudgetRatio, ""))
+	}
+	policy := RetryPolicy{
+		maxAttempts:   max(1, int(env.Int64OrDefault(variables.RetryMaxAttempts, 3))),
+		perTryTimeout: env.DurationOrDefault(variables.RetryPerTryTimeout, 0),
+		backoffBase:   env.DurationOrDefault(variables.RetryBackoffBase, time.Millisecond*25),
+		backoffMax:    env.DurationOrDefault(variables.RetryBackoffMax, time.Millisecond*250),
+		nonIdempotent: make(map[string]struct{}),
+		budget:        newRetryBudget(ratio, int(env.Int64OrDefault(variables.RetryBudgetMinPerSecond, 3))),
+	}
+	for _, item := range strings.Split(env.StringOrDefault(variables.RetryOnStatus, "502,503,504"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		status, err := strconv.Atoi(item)
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid retry status '%s'", item)
+		}
+		policy.statuses = append(policy.statuses, status)
+	}
+	for _, service := range env.StringArrayOrEmpty(variables.RetryNonIdempotent) {
+		policy.nonIdempotent[strings.ToUpper(strings.TrimSpace(service))] = struct{}{}
+	}
+	return &policy, nil
+}
+
+// retryable checks if request to service can be retried
+func (p *RetryPolicy) retryable(request *http.Request, service string) bool {
+	if p.maxAttempts < 2 || request.Header.Get("Upgrade") != "" {
+		return false
+	}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := p.nonIdempotent[strings.ToUpper(service)]
+	return ok
+}
+
+// backoff returns delay before the next attempt ("full jitter" exponential backoff)
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.backoffBase
+	for i := 1; i < attempt && delay < p.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.backoffMax)
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+// region - retry budget
+
+// retryBudget limits retries to a ratio of total requests over a sliding window, so
+// retries can't amplify an outage; small amount of retries per second is always allowed
+type retryBudget struct {
+	mutex        sync.Mutex
+	ratio        float64
+	minPerSecond int
+	buckets      [retryBudgetWindow]budgetBucket
+	now          func() time.Time
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func newRetryBudget(ratio float64, minPerSecond int) *retryBudget {
+	return &retryBudget{
+		ratio:        ratio,
+		minPerSecond: max(0, minPerSecond),
+		now:          time.Now,
+	}
+}
+
+// request registers incoming request
+func (b *retryBudget) request() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.bucket().requests++
+}
+
+// withdraw registers retry if budget is not exhausted
+func (b *retryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	current := b.bucket()
+	requests, retries := 0, 0
+	for _, bucket := range b.buckets {
+		if current.second-bucket.second < retryBudgetWindow {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	if float64(retries+1) > b.ratio*float64(requests)+float64(b.minPerSecond*retryBudgetWindow) {
+		return false
+	}
+	current.retries++
+	return true
+}
+
+// bucket should be called with budget lock held
+func (b *retryBudget) bucket() *budgetBucket {
+	second := b.now().Unix()
+	bucket := &b.buckets[second%retryBudgetWindow]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+	return bucket
+}
+
+// endregion
+// region - transport
+
+// retryTransport sends request to upstream instance, reports call results to registry (outlier detection)
+// and retries failed calls on other service instances according to retry policy
+type retryTransport struct {
+	// transport returns transport for upstream instance (instance may be nil)
+	transport func(instance *registry.Instance) http.RoundTripper
+	policy    *RetryPolicy // nil - no retries
+	resolver  resolver.ServiceResolver
+	instance  *registry.Instance // instance chosen by target resolver
+	logger    logging.Logger
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.policy == nil || t.instance == nil || t.resolver == nil {
+		response, err := t.transport(t.instance).RoundTrip(request)
+		t.report(request, t.instance, response, err)
+		return response, err
+	}
+	t.policy.budget.request()
+
+	service := t.instance.App
+	retryable := t.policy.retryable(request, service)
+	var body []byte
+	if retryable && request.Body != nil && request.Body != http.NoBody {
+		if request.ContentLength < 0 || request.ContentLength > retryBodyLimit {
+			retryable = false
+		} else {
+			var err error
+			if body, err = io.ReadAll(request.Body); err != nil {
+				return nil, err
+			}
+			_ = request.Body.Close()
+		}
+	}
+
+	instance := t.instance
+	tried := []string{instance.Id()}
+	for attempt := 1; ; attempt++ {
+		response, err := t.try(request, instance, body, attempt > 1)
+		if !t.failed(response, err) || !retryable || attempt >= t.policy.maxAttempts || request.Context().Err() != nil {
+			return response, err
+		}
+		if !t.policy.budget.withdraw() {
+			t.logger.Debug("%s: retry budget exhausted", request.URL)
+			return response, err
+		}
+		next, rerr := t.resolver.Resolve(service, registry.Hint{Exclude: tried})
+		if rerr != nil || next == nil {
+			t.logger.Debug("%s: no instance to retry on", request.URL)
+			return response, err
+		}
+		if response != nil {
+			_ = response.Body.Close()
+		}
+		t.logger.Debug("%s: retry on %s (attempt %d)", request.URL, next, attempt+1)
+		select {
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		case <-time.After(t.policy.backoff(attempt)):
+		}
+		instance = next
+		tried = append(tried, instance.Id())
+	}
+}
+
+// try performs single upstream call attempt
+func (t *retryTransport) try(request *http.Request, instance *registry.Instance, body []byte, retry bool) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(request.Context())
+	attempt := request.Clone(ctx)
+	if body != nil {
+		attempt.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if retry {
+		address, err := url.Parse(instance.String())
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if attempt.Host == attempt.URL.Host {
+			// Host header is not preserved (see ForwardingPolicy.PreserveHost)
+			attempt.Host = address.Host
+		}
+		attempt.URL.Scheme = address.Scheme
+		attempt.URL.Host = address.Host
+		// initially selected instance is accounted by gateway
+		instance.Begin()
+	}
+	done := func() {
+		cancel()
+		if retry {
+			instance.End()
+		}
+	}
+
+	var timer *time.Timer
+	if t.policy.perTryTimeout > 0 {
+		timer = time.AfterFunc(t.policy.perTryTimeout, cancel)
+	}
+	response, err := t.transport(instance).RoundTrip(attempt)
+	if timer != nil && !timer.Stop() && err == nil {
+		// response headers came in just as timer fired; body is unusable
+		_ = response.Body.Close()
+		response, err = nil, context.DeadlineExceeded
+	}
+	if err != nil && timer != nil && ctx.Err() != nil && request.Context().Err() == nil {
+		err = fmt.Errorf("%w: %w", errPerTryTimeout, err)
+	}
+	t.report(request, instance, response, err)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		// upgraded connection body must stay io.ReadWriteCloser; context is released with request
+		if retry {
+			instance.End()
+		}
+		return response, nil
+	}
+	response.Body = &attemptBody{ReadCloser: response.Body, done: done}
+	return response, nil
+}
+
+func (t *retryTransport) failed(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return slices.Contains(t.policy.statuses, response.StatusCode)
+}
+
+// report reports upstream call result to registry (used by outlier detection)
+func (t *retryTransport) report(request *http.Request, instance *registry.Instance, response *http.Response, err error) {
+	if instance == nil {
+		return
+	}
+	if err != nil {
+		if errors.Is(request.Context().Err(), context.Canceled) {
+			// client has gone; not an upstream failure
+			return
+		}
+		instance.Report(false)
+		return
+	}
+	instance.Report(response.StatusCode < http.StatusInternalServerError)
+}
+
+// attemptBody releases attempt resources when response body is closed
+type attemptBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// endregion
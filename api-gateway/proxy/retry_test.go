@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/api-gateway/resolver"
+	"github.com/slink-go/logging"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	t.Setenv(variables.RegistryRefreshInitialDelay, "1ms")
+	reg := registry.NewServiceRegistry(discovery.NewStaticClient(map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: u.Hostname(), Port: port},
+			{App: "A", Scheme: "http", Host: "127.0.0.1", Port: closedPort},
+		},
+	}))
+	time.Sleep(time.Millisecond * 100) // initial registry refresh
+	serviceResolver := resolver.NewServiceResolver(reg)
+	dead := findInstance(t, serviceResolver, closedPort)
+
+	t.Setenv(variables.RetryBackoffBase, "1ms")
+	policy, err := NewRetryPolicy()
+	assert.NoError(t, err)
+	transport := func(policy *RetryPolicy) *retryTransport {
+		return &retryTransport{
+			transport: func(*registry.Instance) http.RoundTripper { return http.DefaultTransport },
+			policy:    policy,
+			resolver:  serviceResolver,
+			instance:  dead,
+			logger:    logging.GetLogger("test"),
+		}
+	}
+	request := func(method string) *http.Request {
+		r, _ := http.NewRequest(method, dead.String()+"/path", strings.NewReader("body"))
+		return r
+	}
+
+	// idempotent request is retried on another instance
+	response, err := transport(policy).RoundTrip(request(http.MethodPut))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	assert.Equal(t, "body", string(body))
+	assert.EqualValues(t, 1, calls.Load())
+
+	// non-idempotent request is not retried
+	_, err = transport(policy).RoundTrip(request(http.MethodPost))
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, calls.Load())
+
+	// unless service opts in
+	t.Setenv(variables.RetryNonIdempotent, "a")
+	policy, err = NewRetryPolicy()
+	assert.NoError(t, err)
+	response, err = transport(policy).RoundTrip(request(http.MethodPost))
+	assert.NoError(t, err)
+	_ = response.Body.Close()
+	assert.EqualValues(t, 2, calls.Load())
+
+	// no retries without policy
+	_, err = transport(nil).RoundTrip(request(http.MethodGet))
+	assert.Error(t, err)
+}
+
+func TestRetryTrafficSplit(t *testing.T) {
+	version := func(v string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(v))
+		}))
+	}
+	stable, canary := version("v1"), version("v2")
+	defer stable.Close()
+	defer canary.Close()
+	remote := func(server *httptest.Server, v string) discovery.Remote {
+		u, _ := url.Parse(server.URL)
+		port, _ := strconv.Atoi(u.Port())
+		return discovery.Remote{App: "A", Scheme: "http", Host: u.Hostname(), Port: port, Version: v}
+	}
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	t.Setenv(variables.RegistryRefreshInitialDelay, "1ms")
+	reg := registry.NewServiceRegistry(discovery.NewStaticClient(map[string][]discovery.Remote{
+		"A": {
+			remote(stable, "v1"),
+			remote(canary, "v2"),
+			{App: "A", Scheme: "http", Host: "127.0.0.1", Port: closedPort, Version: "v2"},
+		},
+	}))
+	time.Sleep(time.Millisecond * 100) // initial registry refresh
+	serviceResolver := resolver.NewServiceResolver(reg)
+	dead := findInstance(t, serviceResolver, closedPort)
+	splitter, err := resolver.NewTrafficSplitter(resolver.TrafficSplit{
+		Service: "A",
+		Backends: []resolver.SplitBackend{
+			{Name: "stable", Version: "v1", Weight: 50},
+			{Name: "canary", Version: "v2", Weight: 50},
+		},
+	})
+	assert.NoError(t, err)
+	t.Setenv(variables.RetryBackoffBase, "1ms")
+	t.Setenv(variables.RetryBudgetMinPerSecond, "100")
+	policy, err := NewRetryPolicy()
+	assert.NoError(t, err)
+
+	// request split to canary backend is retried on canary instance only
+	for retried := 0; retried < 10; {
+		request, _ := http.NewRequest(http.MethodGet, dead.String()+"/path", nil)
+		requestResolver := splitter.Resolver(serviceResolver, request)
+		instance, err := requestResolver.Resolve("A", registry.Hint{Instance: dead.Id()})
+		assert.NoError(t, err)
+		if instance != dead {
+			continue // stable backend is chosen
+		}
+		response, err := (&retryTransport{
+			transport: func(*registry.Instance) http.RoundTripper { return http.DefaultTransport },
+			policy:    policy,
+			resolver:  requestResolver,
+			instance:  instance,
+			logger:    logging.GetLogger("test"),
+		}).RoundTrip(request)
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(response.Body)
+			_ = response.Body.Close()
+			assert.Equal(t, "v2", string(body))
+		}
+		retried++
+	}
+}
+
+func TestRetryPreserveHost(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	t.Setenv(variables.RegistryRefreshInitialDelay, "1ms")
+	reg := registry.NewServiceRegistry(discovery.NewStaticClient(map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: u.Hostname(), Port: port},
+			{App: "A", Scheme: "http", Host: "127.0.0.1", Port: closedPort},
+		},
+	}))
+	time.Sleep(time.Millisecond * 100) // initial registry refresh
+	serviceResolver := resolver.NewServiceResolver(reg)
+	dead := findInstance(t, serviceResolver, closedPort)
+	t.Setenv(variables.RetryBackoffBase, "1ms")
+	policy, err := NewRetryPolicy()
+	assert.NoError(t, err)
+
+	for preserve, expected := range map[bool]string{true: "client.example.com", false: u.Host} {
+		host = ""
+		forwarding := &ForwardingPolicy{mode: ForwardedAppend, preserveHost: map[string]struct{}{}}
+		if preserve {
+			forwarding.preserveHost["A"] = struct{}{}
+		}
+		p := CreateReverseProxy().
+			WithServiceResolver(serviceResolver).
+			WithRetryPolicy(policy).
+			WithForwardingPolicy(forwarding)
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "http://client.example.com/path", nil)
+		ctx.Set(constants.CtxProxyInstance, dead)
+		ctx.Set(constants.CtxProxyService, "A")
+		address, _ := url.Parse(dead.String() + "/path")
+		recorder := httptest.NewRecorder()
+		p.Proxy(ctx, address).ServeHTTP(recorder, ctx.Request)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, expected, host, "preserve host: %v", preserve)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	budget := newRetryBudget(0.1, 0)
+	budget.now = func() time.Time { return now }
+	assert.False(t, budget.withdraw())
+	for i := 0; i < 20; i++ {
+		budget.request()
+	}
+	assert.True(t, budget.withdraw())
+	assert.True(t, budget.withdraw())
+	assert.False(t, budget.withdraw())
+
+	// window slides
+	now = now.Add(time.Second * retryBudgetWindow)
+	assert.False(t, budget.withdraw())
+
+	budget = newRetryBudget(0, 1)
+	budget.now = func() time.Time { return now }
+	for i := 0; i < retryBudgetWindow; i++ {
+		assert.True(t, budget.withdraw())
+	}
+	assert.False(t, budget.withdraw())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{backoffBase: time.Millisecond * 10, backoffMax: time.Millisecond * 30}
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, policy.backoff(1), time.Millisecond*10)
+		assert.LessOrEqual(t, policy.backoff(5), time.Millisecond*30)
+	}
+}
+
+func findInstance(t *testing.T, serviceResolver resolver.ServiceResolver, port int) *registry.Instance {
+	for i := 0; i < 4; i++ {
+		instance, err := serviceResolver.Resolve("A", registry.Hint{})
+		assert.NoError(t, err)
+		if instance.Port == port {
+			return instance
+		}
+	}
+	t.Fatalf("instance with port %d not found", port)
+	return nil
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/slink-go/api-gateway/certificate"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	upstreamConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "void_upstream_connections_total",
+		Help: "Number of connections obtained for upstream requests (reused - taken from idle pool)",
+	}, []string{"upstream", "reused"})
+	upstreamOpenConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "void_upstream_open_connections",
+		Help: "Number of open upstream connections (in use and idle)",
+	}, []string{"upstream"})
+)
+
+// TransportSettings configures upstream connection pools
+type TransportSettings struct {
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int                        // 0 - no limit
+	IdleConnTimeout       time.Duration              // 0 - idle connections are kept until closed by upstream
+	ResponseHeaderTimeout time.Duration              // 0 - no limit
+	TLS                   certificate.ClientSettings // may be overridden by instance metadata
+}
+
+func NewTransportSettings() TransportSettings {
+	return TransportSettings{
+		DialTimeout:           env.DurationOrDefault(variables.TargetConnTimeout, 1*time.Second),
+		KeepAlive:             env.DurationOrDefault(variables.TargetConnKeepAlive, 5*time.Second),
+		TLSHandshakeTimeout:   env.DurationOrDefault(variables.TargetTLSHandshakeTimeout, 1*time.Second),
+		MaxIdleConnsPerHost:   int(env.Int64OrDefault(variables.TargetMaxIdleConnsPerHost, 32)),
+		MaxConnsPerHost:       int(env.Int64OrDefault(variables.TargetMaxConnsPerHost, 0)),
+		IdleConnTimeout:       env.DurationOrDefault(variables.TargetIdleConnTimeout, 90*time.Second),
+		ResponseHeaderTimeout: env.DurationOrDefault(variables.TargetResponseHeaderTimeout, 0),
+		TLS: certificate.ClientSettings{
+			CAFile:             env.StringOrDefault(variables.TargetTLSCAFile, ""),
+			CertFile:           env.StringOrDefault(variables.TargetTLSCertFile, ""),
+			KeyFile:            env.StringOrDefault(variables.TargetTLSKeyFile, ""),
+			ServerName:         env.StringOrDefault(variables.TargetTLSServerName, ""),
+			SkipVerifyHostname: !env.BoolOrDefault(variables.TargetTLSVerifyHostname, true),
+			InsecureSkipVerify: env.BoolOrDefault(variables.TargetTLSInsecureSkipVerify, false),
+		},
+	}
+}
+
+// tlsSettings overrides upstream TLS settings with instance metadata (see discovery.MetaTLS* keys)
+func tlsSettings(settings certificate.ClientSettings, meta map[string]string) certificate.ClientSettings {
+	if v, ok := meta[discovery.MetaTLSCA]; ok {
+		settings.CAFile = v
+	}
+	if v, ok := meta[discovery.MetaTLSCert]; ok {
+		settings.CertFile = v
+	}
+	if v, ok := meta[discovery.MetaTLSKey]; ok {
+		settings.KeyFile = v
+	}
+	if v, ok := meta[discovery.MetaTLSServerName]; ok {
+		settings.ServerName = v
+	}
+	if v, err := strconv.ParseBool(meta[discovery.MetaTLSVerifyHostname]); err == nil {
+		settings.SkipVerifyHostname = !v
+	}
+	if v, err := strconv.ParseBool(meta[discovery.MetaTLSInsecureSkipVerify]); err == nil {
+		settings.InsecureSkipVerify = v
+	}
+	return settings
+}
+
+// failedTransportTTL is how long transport creation failure (e.g. missing TLS files) is cached
+const failedTransportTTL = 10 * time.Second
+
+// TransportPool keeps long-lived upstream transport per service (per host for literal URL
+// routes), so connections to upstream instances are reused between requests; instances with
+// own TLS settings (see discovery.MetaTLS* metadata keys) get separate transports
+type TransportPool struct {
+	mutex      sync.RWMutex
+	settings   TransportSettings
+	transports map[string]*pooledTransport
+	failures   map[string]*failedTransport
+	logger     logging.Logger
+}
+
+func NewTransportPool(settings TransportSettings) *TransportPool {
+	return &TransportPool{
+		settings:   settings,
+		transports: make(map[string]*pooledTransport),
+		failures:   make(map[string]*failedTransport),
+		logger:     logging.GetLogger("transport"),
+	}
+}
+
+// Get returns transport for upstream (service name or host) and instance metadata (nil for literal URL routes);
+// if TLS config can not be created, returned transport fails requests (transport creation is retried
+// after failedTransportTTL)
+func (p *TransportPool) Get(upstream string, meta map[string]string) http.RoundTripper {
+	upstream = strings.ToUpper(upstream)
+	settings := tlsSettings(p.settings.TLS, meta)
+	key := upstream
+	if !settings.IsZero() {
+		key += "|" + settings.String()
+	}
+	p.mutex.RLock()
+	if transport, ok := p.lookup(key); ok {
+		p.mutex.RUnlock()
+		return transport
+	}
+	p.mutex.RUnlock()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if transport, ok := p.lookup(key); ok {
+		return transport
+	}
+	transport, err := p.newTransport(upstream, settings)
+	if err != nil {
+		p.logger.Error("%s: upstream TLS config error: %s; retry in %s", upstream, err, failedTransportTTL)
+		failure := &failedTransport{
+			err:     fmt.Errorf("upstream TLS config: %w", err),
+			expires: time.Now().Add(failedTransportTTL),
+		}
+		p.failures[key] = failure
+		return failure
+	}
+	delete(p.failures, key)
+	p.transports[key] = transport
+	return transport
+}
+
+// lookup should be called with pool lock held
+func (p *TransportPool) lookup(key string) (http.RoundTripper, bool) {
+	if transport, ok := p.transports[key]; ok {
+		return transport, true
+	}
+	if failure, ok := p.failures[key]; ok && time.Now().Before(failure.expires) {
+		return failure, true
+	}
+	return nil, false
+}
+
+// Close closes idle connections of all transports
+func (p *TransportPool) Close() {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, transport := range p.transports {
+		transport.transport.CloseIdleConnections()
+	}
+}
+
+func (p *TransportPool) newTransport(upstream string, settings certificate.ClientSettings) (*pooledTransport, error) {
+	dialer := &net.Dialer{
+		Timeout:   p.settings.DialTimeout,
+		KeepAlive: p.settings.KeepAlive,
+	}
+	openConnections := upstreamOpenConnections.WithLabelValues(upstream)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		openConnections.Inc()
+		return &countedConn{Conn: conn, gauge: openConnections}, nil
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		TLSHandshakeTimeout:   p.settings.TLSHandshakeTimeout,
+		MaxIdleConns:          0, // limited per host
+		MaxIdleConnsPerHost:   p.settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.settings.MaxConnsPerHost,
+		IdleConnTimeout:       p.settings.IdleConnTimeout,
+		ResponseHeaderTimeout: p.settings.ResponseHeaderTimeout,
+	}
+	if !settings.IsZero() {
+		clientConfig, err := certificate.NewClientConfig(settings)
+		if err != nil {
+			return nil, err
+		}
+		// TLS handshake is made here, so that upstream certificate is verified for the dialed host
+		// (incl. IP addresses, which are not sent as SNI); connections via HTTP proxy use default TLS settings
+		transport.DialTLSContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(address)
+			tlsConn := tls.Client(conn, clientConfig.Config(host))
+			if p.settings.TLSHandshakeTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, p.settings.TLSHandshakeTimeout)
+				defer cancel()
+			}
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+	}
+	return &pooledTransport{
+		transport: transport,
+		reused:    upstreamConnections.WithLabelValues(upstream, strconv.FormatBool(true)),
+		created:   upstreamConnections.WithLabelValues(upstream, strconv.FormatBool(false)),
+	}, nil
+}
+
+// region - transport
+
+type pooledTransport struct {
+	transport *http.Transport
+	reused    prometheus.Counter
+	created   prometheus.Counter
+}
+
+func (t *pooledTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.reused.Inc()
+			} else {
+				t.created.Inc()
+			}
+		},
+	}
+	return t.transport.RoundTrip(request.WithContext(httptrace.WithClientTrace(request.Context(), trace)))
+}
+
+// failedTransport fails requests to upstream with invalid transport configuration
+type failedTransport struct {
+	err     error
+	expires time.Time
+}
+
+func (t *failedTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// countedConn tracks open connections gauge
+type countedConn struct {
+	net.Conn
+	gauge prometheus.Gauge
+	once  sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(c.gauge.Dec)
+	return c.Conn.Close()
+}
+
+// endregion
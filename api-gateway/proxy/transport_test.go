@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/middleware/constants"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestUpstream(tb testing.TB) (*httptest.Server, discovery.Remote) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return upstream, discovery.Remote{App: "SERVICE-A", Scheme: "http", Host: u.Hostname(), Port: port}
+}
+
+// proxyRequest proxies request to the instance as gateway does
+func proxyRequest(tb testing.TB, p *ReverseProxy, instance *registry.Instance) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/service-a/items", nil)
+	ctx.Set(constants.CtxProxyInstance, instance)
+	address, _ := url.Parse(instance.String() + "/items")
+	w := httptest.NewRecorder()
+	p.Proxy(ctx, address).ServeHTTP(w, ctx.Request)
+	if w.Code != http.StatusOK {
+		tb.Fatalf("unexpected status %d", w.Code)
+	}
+	_, _ = io.Copy(io.Discard, w.Body)
+}
+
+func TestTransportPool(t *testing.T) {
+	upstream, remote := newTestUpstream(t)
+	defer upstream.Close()
+	instance := &registry.Instance{Remote: remote}
+	p := CreateReverseProxy().WithServiceResolver(shadowResolver{remote})
+
+	created := testutil.ToFloat64(upstreamConnections.WithLabelValues("SERVICE-A", "false"))
+	reused := testutil.ToFloat64(upstreamConnections.WithLabelValues("SERVICE-A", "true"))
+	open := testutil.ToFloat64(upstreamOpenConnections.WithLabelValues("SERVICE-A"))
+	for i := 0; i < 10; i++ {
+		proxyRequest(t, p, instance)
+	}
+	assert.Equal(t, created+1, testutil.ToFloat64(upstreamConnections.WithLabelValues("SERVICE-A", "false")))
+	assert.Equal(t, reused+9, testutil.ToFloat64(upstreamConnections.WithLabelValues("SERVICE-A", "true")))
+	assert.Equal(t, open+1, testutil.ToFloat64(upstreamOpenConnections.WithLabelValues("SERVICE-A")))
+	p.transports.Close()
+	assert.Equal(t, open, testutil.ToFloat64(upstreamOpenConnections.WithLabelValues("SERVICE-A")))
+
+	// transports are kept per upstream
+	pool := NewTransportPool(TransportSettings{IdleConnTimeout: time.Millisecond * 50})
+	assert.Same(t, pool.Get("service-a", nil), pool.Get("SERVICE-A", nil))
+	assert.NotSame(t, pool.Get("service-a", nil), pool.Get("service-b", nil))
+
+	// instances with own TLS settings get separate transports; invalid TLS settings fail requests
+	insecure := map[string]string{discovery.MetaTLSInsecureSkipVerify: "true"}
+	assert.Same(t, pool.Get("service-a", insecure), pool.Get("service-a", insecure))
+	assert.NotSame(t, pool.Get("service-a", nil), pool.Get("service-a", insecure))
+	missing := map[string]string{discovery.MetaTLSCA: "missing.pem"}
+	_, err := pool.Get("service-a", missing).RoundTrip(httptest.NewRequest(http.MethodGet, "https://service-a", nil))
+	assert.Error(t, err)
+	// failure is cached, files are not re-read on every request
+	assert.Same(t, pool.Get("service-a", missing), pool.Get("service-a", missing))
+
+	// idle connections are closed after idle timeout
+	p.WithTransportPool(pool)
+	proxyRequest(t, p, instance)
+	assert.Equal(t, open+1, testutil.ToFloat64(upstreamOpenConnections.WithLabelValues("SERVICE-A")))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(upstreamOpenConnections.WithLabelValues("SERVICE-A")) == open
+	}, time.Second, time.Millisecond*10)
+}
+
+// BenchmarkProxyTransport compares shared transport pool with transport created per request
+func BenchmarkProxyTransport(b *testing.B) {
+	upstream, remote := newTestUpstream(b)
+	defer upstream.Close()
+	instance := &registry.Instance{Remote: remote}
+	settings := NewTransportSettings()
+
+	b.Run("shared", func(b *testing.B) {
+		p := CreateReverseProxy().
+			WithServiceResolver(shadowResolver{remote}).
+			WithTransportPool(NewTransportPool(settings))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			proxyRequest(b, p, instance)
+		}
+	})
+	b.Run("per-request", func(b *testing.B) {
+		p := CreateReverseProxy().WithServiceResolver(shadowResolver{remote})
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pool := NewTransportPool(settings)
+			proxyRequest(b, p.WithTransportPool(pool), instance)
+			pool.Close()
+		}
+	})
+}
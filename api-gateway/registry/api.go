@@ -2,9 +2,24 @@ package registry
 
 import (
 	"github.com/slink-go/api-gateway/discovery"
+	"net/http"
 )
 
 type ServiceRegistry interface {
-	Get(applicationId string) (string, error)
-	List() []discovery.Remote
+	Get(applicationId string, hint Hint) (*Instance, error)
+	List() []InstanceStatus
+	UseTransports(transports Transports)
+}
+
+// Transports provides transports for requests to instances (with instance TLS settings), see proxy.TransportPool
+type Transports interface {
+	Get(upstream string, meta map[string]string) http.RoundTripper
+}
+
+// InstanceStatus is a snapshot of registry instance state (used for monitoring)
+type InstanceStatus struct {
+	discovery.Remote
+	Health      string `json:"health,omitempty"`
+	Outstanding int64  `json:"outstanding"`
+	Ejected     bool   `json:"ejected,omitempty"`
 }
@@ -6,12 +6,16 @@ import (
 )
 
 type ErrServiceUnavailable struct {
+	service string
 	message string
 }
 
 func (err *ErrServiceUnavailable) Error() string {
 	return err.message
 }
+func (err *ErrServiceUnavailable) Service() string {
+	return err.service
+}
 func (err *ErrServiceUnavailable) Is(other error) bool {
 	var errRef *ErrServiceUnavailable
 	return errors.As(other, &errRef)
@@ -19,6 +23,7 @@ func (err *ErrServiceUnavailable) Is(other error) bool {
 
 func NewErrServiceUnavailable(serviceName string) error {
 	return &ErrServiceUnavailable{
+		service: serviceName,
 		message: fmt.Sprintf("service unavailable: %s", serviceName),
 	}
 }
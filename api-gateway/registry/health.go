@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HealthCheckHttp = "http"
+	HealthCheckTcp  = "tcp"
+	HealthCheckNone = "none"
+)
+
+const (
+	HealthUnknown   = "UNKNOWN"
+	HealthHealthy   = "HEALTHY"
+	HealthUnhealthy = "UNHEALTHY"
+)
+
+type healthCheck struct {
+	kind     string // http, tcp or none
+	path     string
+	statuses []statusRange
+}
+
+type statusRange struct {
+	from, to int
+}
+
+// healthChecker periodically probes all registry instances; instances failing
+// `unhealthyThreshold` consecutive checks are removed from load balancing rotation
+// until they pass `healthyThreshold` consecutive checks
+type healthChecker struct {
+	registry           *serviceRegistry
+	interval           time.Duration
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+	check              healthCheck
+	checks             map[string]healthCheck // service -> custom health check
+	client             *http.Client
+	logger             logging.Logger
+}
+
+func newHealthChecker(registry *serviceRegistry) (*healthChecker, error) {
+	check, err := parseHealthCheck(
+		env.StringOrDefault(variables.HealthCheckType, HealthCheckHttp),
+		env.StringOrDefault(variables.HealthCheckPath, "/"),
+		env.StringOrDefault(variables.HealthCheckStatus, "200-399"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	hc := healthChecker{
+		registry:           registry,
+		interval:           env.DurationOrDefault(variables.HealthCheckInterval, time.Second*10),
+		timeout:            env.DurationOrDefault(variables.HealthCheckTimeout, time.Second*2),
+		healthyThreshold:   max(1, int(env.Int64OrDefault(variables.HealthCheckHealthyThreshold, 2))),
+		unhealthyThreshold: max(1, int(env.Int64OrDefault(variables.HealthCheckUnhealthyThreshold, 3))),
+		check:              check,
+		checks:             make(map[string]healthCheck),
+		logger:             logging.GetLogger("health-check"),
+	}
+	// custom checks: "{service}:{type}[:{path}],..."
+	for _, item := range env.StringArrayOrEmpty(variables.HealthCheckCustom) {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) < 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid custom health check config '%s'", item)
+		}
+		path := check.path
+		if len(parts) == 3 {
+			path = parts[2]
+		}
+		custom, err := parseHealthCheck(parts[1], path, "")
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", parts[0], err)
+		}
+		custom.statuses = check.statuses
+		hc.checks[strings.ToUpper(strings.TrimSpace(parts[0]))] = custom
+	}
+	hc.client = &http.Client{
+		Timeout: hc.timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &hc, nil
+}
+
+func (hc *healthChecker) run() {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		hc.checkAll()
+	}
+}
+func (hc *healthChecker) checkAll() {
+	var wg sync.WaitGroup
+	for service, instances := range hc.registry.instances() {
+		check, ok := hc.checks[service]
+		if !ok {
+			check = hc.check
+		}
+		if check.kind == HealthCheckNone {
+			continue
+		}
+		for _, instance := range instances {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := hc.probe(check, instance)
+				if instance.reportHealth(err == nil, hc.healthyThreshold, hc.unhealthyThreshold) {
+					if err == nil {
+						hc.logger.Info("%s %s is healthy", service, instance)
+					} else {
+						hc.logger.Warning("%s %s is unhealthy: %s", service, instance, err)
+					}
+				} else if err != nil {
+					hc.logger.Debug("%s %s check failed: %s", service, instance, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+func (hc *healthChecker) probe(check healthCheck, instance *Instance) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.timeout)
+	defer cancel()
+	switch check.kind {
+	case HealthCheckTcp:
+		address := net.JoinHostPort(strings.Trim(instance.Host, "[]"), strconv.Itoa(instance.Port))
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, instance.String()+check.path, nil)
+		if err != nil {
+			return err
+		}
+		client := *hc.client
+		client.Transport = hc.registry.transport(instance)
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		_ = response.Body.Close()
+		for _, r := range check.statuses {
+			if response.StatusCode >= r.from && response.StatusCode <= r.to {
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+}
+
+// parseHealthCheck parses health check type, path and expected status list ("200,204,300-399")
+func parseHealthCheck(kind, path, statuses string) (healthCheck, error) {
+	result := healthCheck{
+		kind: strings.ToLower(strings.TrimSpace(kind)),
+		path: strings.TrimSpace(path),
+	}
+	switch result.kind {
+	case HealthCheckHttp, HealthCheckTcp, HealthCheckNone:
+	default:
+		return result, fmt.Errorf("unknown health check type: '%s'", kind)
+	}
+	if result.path != "" && !strings.HasPrefix(result.path, "/") {
+		result.path = "/" + result.path
+	}
+	for _, item := range strings.Split(statuses, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return result, fmt.Errorf("invalid health check status '%s'", item)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || to < from {
+				return result, fmt.Errorf("invalid health check status '%s'", item)
+			}
+		}
+		result.statuses = append(result.statuses, statusRange{from, to})
+	}
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	// closed port for tcp check
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	remotes := map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: u.Hostname(), Port: port},
+			{App: "A", Scheme: "http", Host: "127.0.0.1", Port: closedPort},
+		},
+		"B": {
+			{App: "B", Scheme: "http", Host: "127.0.0.1", Port: closedPort},
+		},
+	}
+	t.Setenv(variables.HealthCheckPath, "/health")
+	t.Setenv(variables.HealthCheckHealthyThreshold, "2")
+	t.Setenv(variables.HealthCheckUnhealthyThreshold, "2")
+	t.Setenv(variables.HealthCheckCustom, "B:tcp")
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	registry.doRefresh()
+	checker, err := newHealthChecker(registry)
+	assert.NoError(t, err)
+	registry.healthChecker = checker
+
+	// unhealthy threshold is not reached yet
+	checker.checkAll()
+	assert.Len(t, registry.serviceDirectory["A"].available(), 2)
+
+	checker.checkAll()
+	assert.Len(t, registry.serviceDirectory["A"].available(), 1)
+	for i := 0; i < 5; i++ {
+		instance, err := registry.Get("A", Hint{})
+		assert.NoError(t, err)
+		assert.Equal(t, port, instance.Port)
+	}
+	_, err = registry.Get("B", Hint{})
+	assert.ErrorIs(t, err, NewErrServiceUnavailable("B"))
+
+	statuses := registry.List()
+	assert.Len(t, statuses, 3)
+	health := make(map[string]string)
+	for _, s := range statuses {
+		health[s.String()] = s.Health
+	}
+	assert.Equal(t, HealthHealthy, health[server.URL])
+	assert.Equal(t, HealthUnhealthy, health["http://127.0.0.1:"+strconv.Itoa(closedPort)])
+
+	// unexpected status code
+	status.Store(http.StatusServiceUnavailable)
+	checker.checkAll()
+	checker.checkAll()
+	_, err = registry.Get("A", Hint{})
+	assert.ErrorIs(t, err, NewErrServiceUnavailable("A"))
+
+	// recovery requires healthy threshold to be reached
+	status.Store(http.StatusNoContent)
+	checker.checkAll()
+	_, err = registry.Get("A", Hint{})
+	assert.Error(t, err)
+	checker.checkAll()
+	_, err = registry.Get("A", Hint{})
+	assert.NoError(t, err)
+}
+
+type testTransports struct {
+	transport http.RoundTripper
+	meta      atomic.Pointer[map[string]string]
+}
+
+func (t *testTransports) Get(_ string, meta map[string]string) http.RoundTripper {
+	t.meta.Store(&meta)
+	return t.transport
+}
+
+func TestHealthCheckTransports(t *testing.T) {
+	// upstream certificate is not trusted by default transport
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	meta := map[string]string{discovery.MetaTLSCA: "ca.pem"}
+	remotes := map[string][]discovery.Remote{
+		"A": {discovery.Remote{App: "A", Scheme: "https", Host: u.Hostname(), Port: port}.WithMeta(meta)},
+	}
+	t.Setenv(variables.HealthCheckUnhealthyThreshold, "1")
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	registry.doRefresh()
+	checker, err := newHealthChecker(registry)
+	assert.NoError(t, err)
+	registry.healthChecker = checker
+
+	checker.checkAll()
+	_, err = registry.Get("A", Hint{})
+	assert.Error(t, err)
+
+	// instance transport (with instance TLS settings) is used
+	transports := testTransports{transport: server.Client().Transport}
+	registry.UseTransports(&transports)
+	checker.checkAll()
+	checker.checkAll()
+	_, err = registry.Get("A", Hint{})
+	assert.NoError(t, err)
+	assert.Equal(t, meta, *transports.meta.Load())
+}
+
+func TestParseHealthCheck(t *testing.T) {
+	check, err := parseHealthCheck("HTTP", "health", "200, 300-399")
+	assert.NoError(t, err)
+	assert.Equal(t, healthCheck{kind: HealthCheckHttp, path: "/health", statuses: []statusRange{{200, 200}, {300, 399}}}, check)
+	_, err = parseHealthCheck("udp", "", "")
+	assert.Error(t, err)
+	_, err = parseHealthCheck("http", "/", "399-300")
+	assert.Error(t, err)
+}
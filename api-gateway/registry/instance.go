@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/slink-go/api-gateway/discovery"
+	"sync"
+	"sync/atomic"
+)
+
+// Hint carries request attributes used for instance selection
+type Hint struct {
+	HashKey  string   // request key for hash-based load balancing strategies
+	Instance string   // preferred instance id (sticky session); ignored if instance is gone
+	Exclude  []string // instance ids which should not be selected (e.g. already failed on retry)
+	Version  string   // instance subset: only instances of this version can be selected
+	DryRun   bool     // selection is not recorded (balancer state is not changed, ejected instance trial request is not started)
+}
+
+// Instance is a service instance known to registry; its state (requests in flight, health)
+// survives registry refreshes as long as instance is still discovered
+type Instance struct {
+	discovery.Remote
+	id       string
+	state    *instanceState
+	detector *outlierDetector
+}
+
+type instanceState struct {
+	outstanding atomic.Int64
+	unhealthy   atomic.Bool
+	ejected     atomic.Bool
+	mutex       sync.Mutex
+	checked     bool
+	successes   int // consecutive successful health checks
+	failures    int // consecutive failed health checks
+	outlier     outlierState
+}
+
+func newInstance(remote discovery.Remote, previous *Instance) *Instance {
+	instance := Instance{
+		Remote: remote,
+		id:     instanceId(remote),
+	}
+	if previous != nil {
+		instance.state = previous.state
+	} else {
+		instance.state = &instanceState{}
+	}
+	return &instance
+}
+
+// Id returns opaque instance identifier (safe to expose to clients, e.g. in affinity cookie)
+func (i *Instance) Id() string {
+	return i.id
+}
+
+// Begin should be called by proxy when request to the instance is started
+func (i *Instance) Begin() {
+	i.state.outstanding.Add(1)
+}
+
+// End should be called by proxy when request to the instance is finished
+func (i *Instance) End() {
+	i.state.outstanding.Add(-1)
+}
+
+// Outstanding returns the number of requests in flight
+func (i *Instance) Outstanding() int64 {
+	return i.state.outstanding.Load()
+}
+
+// Report should be called by proxy with upstream call result
+// (used for passive outlier detection)
+func (i *Instance) Report(ok bool) {
+	if i.detector != nil {
+		i.detector.report(i, ok)
+	}
+}
+
+// Healthy reports if instance passes health checks
+// (instance is considered healthy until health checks prove otherwise)
+func (i *Instance) Healthy() bool {
+	return !i.state.unhealthy.Load()
+}
+
+func (i *Instance) inRotation() bool {
+	if !i.Healthy() {
+		return false
+	}
+	if i.Ejected() && i.detector != nil {
+		return i.detector.available(i)
+	}
+	return true
+}
+
+// Ejected reports if instance is ejected from load balancing rotation by outlier detection
+func (i *Instance) Ejected() bool {
+	return i.state.ejected.Load()
+}
+
+// reportHealth records health check result; instance state is switched
+// after the number of consecutive results reaches threshold; returns true if state has changed
+func (i *Instance) reportHealth(ok bool, healthyThreshold, unhealthyThreshold int) bool {
+	i.state.mutex.Lock()
+	defer i.state.mutex.Unlock()
+	i.state.checked = true
+	if ok {
+		i.state.successes++
+		i.state.failures = 0
+		if i.state.unhealthy.Load() && i.state.successes >= healthyThreshold {
+			i.state.unhealthy.Store(false)
+			return true
+		}
+	} else {
+		i.state.failures++
+		i.state.successes = 0
+		if !i.state.unhealthy.Load() && i.state.failures >= unhealthyThreshold {
+			i.state.unhealthy.Store(true)
+			return true
+		}
+	}
+	return false
+}
+func (i *Instance) healthChecked() bool {
+	i.state.mutex.Lock()
+	defer i.state.mutex.Unlock()
+	return i.state.checked
+}
+
+// EffectiveWeight returns instance load balancing weight (1 if not set)
+func (i *Instance) EffectiveWeight() int {
+	if i.Weight > 0 {
+		return i.Weight
+	}
+	return 1
+}
+
+func instanceId(remote discovery.Remote) string {
+	sum := sha256.Sum256([]byte(remote.String()))
+	return hex.EncodeToString(sum[:8])
+}
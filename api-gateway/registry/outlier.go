@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/logging"
+	"github.com/slink-go/util/env"
+	"strings"
+	"time"
+)
+
+type outlierState struct {
+	errors       int       // consecutive failed upstream calls
+	ejections    int       // number of successive ejections (ejection time grows exponentially)
+	ejectedUntil time.Time // end of current ejection
+	probing      bool      // half-open: trial request is in flight
+	probeStarted time.Time
+}
+
+// outlierDetector implements passive outlier detection (per-instance circuit breaker):
+// instance failing `consecutiveErrors` upstream calls in a row is ejected from load balancing
+// rotation for baseEjectionTime * 2^(ejections-1) (up to maxEjectionTime); after that it gets
+// single trial request (half-open state), success returns instance to rotation, failure ejects it again;
+// no more than maxEjectionPercent of service instances can be ejected at the same time
+type outlierDetector struct {
+	registry           *serviceRegistry
+	consecutiveErrors  int
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent int
+	logger             logging.Logger
+	now                func() time.Time
+}
+
+func newOutlierDetector(registry *serviceRegistry) *outlierDetector {
+	return &outlierDetector{
+		registry:           registry,
+		consecutiveErrors:  max(1, int(env.Int64OrDefault(variables.OutlierConsecutiveErrors, 5))),
+		baseEjectionTime:   env.DurationOrDefault(variables.OutlierBaseEjectionTime, time.Second*30),
+		maxEjectionTime:    env.DurationOrDefault(variables.OutlierMaxEjectionTime, time.Minute*5),
+		maxEjectionPercent: min(100, max(0, int(env.Int64OrDefault(variables.OutlierMaxEjectionPercent, 50)))),
+		logger:             logging.GetLogger("outlier-detector"),
+		now:                time.Now,
+	}
+}
+
+func (d *outlierDetector) report(instance *Instance, ok bool) {
+	var service []*Instance
+	if !ok {
+		// should be taken before instance state lock (see available)
+		service = d.registry.instances()[strings.ToUpper(instance.App)]
+	}
+	state := instance.state
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if ok {
+		state.outlier.errors = 0
+		if state.outlier.probing {
+			state.outlier.probing = false
+			state.ejected.Store(false)
+			d.logger.Info("%s %s is back to rotation", instance.App, instance)
+		}
+		return
+	}
+
+	state.outlier.errors++
+	switch {
+	case state.outlier.probing:
+		state.outlier.probing = false
+		d.eject(instance)
+	case state.ejected.Load():
+		// late result of request started before ejection
+	case state.outlier.errors >= d.consecutiveErrors:
+		if d.canEject(instance, service) {
+			d.eject(instance)
+		} else {
+			d.logger.Warning("%s %s: max ejected instances percent reached; keep in rotation", instance.App, instance)
+		}
+	}
+}
+
+// eject should be called with instance state lock held
+func (d *outlierDetector) eject(instance *Instance) {
+	state := instance.state
+	now := d.now()
+	if !state.outlier.ejectedUntil.IsZero() && now.Sub(state.outlier.ejectedUntil) > d.maxEjectionTime {
+		// instance has been stable for a while; start over
+		state.outlier.ejections = 0
+	}
+	state.outlier.ejections++
+	duration := d.baseEjectionTime
+	for i := 1; i < state.outlier.ejections && duration < d.maxEjectionTime; i++ {
+		duration *= 2
+	}
+	duration = min(duration, d.maxEjectionTime)
+	state.outlier.ejectedUntil = now.Add(duration)
+	state.outlier.errors = 0
+	state.ejected.Store(true)
+	d.logger.Warning("%s %s is ejected for %s", instance.App, instance, duration)
+}
+
+// canEject checks max ejection percent limit for instance service
+func (d *outlierDetector) canEject(instance *Instance, instances []*Instance) bool {
+	if len(instances) == 0 {
+		return false
+	}
+	ejected := 1
+	for _, v := range instances {
+		if v.state != instance.state && v.Ejected() {
+			ejected++
+		}
+	}
+	return ejected*100 <= d.maxEjectionPercent*len(instances)
+}
+
+// available checks if ejected instance can receive trial request (should be called with registry read lock);
+// returns true when instance is in half-open state and no trial request is in flight
+func (d *outlierDetector) available(instance *Instance) bool {
+	state := instance.state
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return !state.ejected.Load() || d.probeAvailable(state)
+}
+
+// probeAvailable should be called with instance state lock held
+func (d *outlierDetector) probeAvailable(state *instanceState) bool {
+	now := d.now()
+	if now.Before(state.outlier.ejectedUntil) {
+		return false
+	}
+	// trial request result is lost (e.g. request was aborted before reaching upstream)
+	if state.outlier.probing && now.Sub(state.outlier.probeStarted) < d.baseEjectionTime {
+		return false
+	}
+	return true
+}
+
+// selected claims trial request of half-open instance; concurrent requests may choose the same
+// instance (it is available until probing is marked), so availability check and probing mark are
+// made atomically (compare-and-set under instance state lock): only one of them gets the instance
+func (d *outlierDetector) selected(instance *Instance) bool {
+	state := instance.state
+	if !state.ejected.Load() {
+		return true
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if !state.ejected.Load() {
+		return true
+	}
+	if !d.probeAvailable(state) {
+		return false
+	}
+	state.outlier.probing = true
+	state.outlier.probeStarted = d.now()
+	return true
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"github.com/slink-go/api-gateway/cmd/common/variables"
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	remotes := map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3101},
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3102},
+		},
+	}
+	t.Setenv(variables.OutlierDetectionEnabled, "true")
+	t.Setenv(variables.OutlierConsecutiveErrors, "2")
+	t.Setenv(variables.OutlierBaseEjectionTime, "10s")
+	t.Setenv(variables.OutlierMaxEjectionTime, "30s")
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	now := time.Now()
+	registry.outlierDetector.now = func() time.Time { return now }
+	registry.doRefresh()
+
+	pool := registry.serviceDirectory["A"]
+	bad, good := pool.instances[0], pool.instances[1]
+
+	// non-consecutive errors are tolerated
+	bad.Report(false)
+	bad.Report(true)
+	bad.Report(false)
+	assert.Len(t, pool.available(), 2)
+
+	bad.Report(false)
+	assert.True(t, bad.Ejected())
+	assert.Equal(t, []*Instance{good}, pool.available())
+
+	// max ejection percent (50%) protects the last instance
+	good.Report(false)
+	good.Report(false)
+	assert.False(t, good.Ejected())
+
+	// half-open: single trial request after ejection time
+	now = now.Add(10 * time.Second)
+	assert.Len(t, pool.available(), 2)
+	for i := 0; i < 2; i++ {
+		registry.Get("A", Hint{Instance: bad.Id()})
+	}
+	assert.Equal(t, []*Instance{good}, pool.available())
+
+	// trial failure: ejection time is doubled
+	bad.Report(false)
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, []*Instance{good}, pool.available())
+	now = now.Add(10 * time.Second)
+	assert.Len(t, pool.available(), 2)
+
+	// trial success: instance is back to rotation
+	instance, err := registry.Get("A", Hint{Instance: bad.Id()})
+	assert.NoError(t, err)
+	instance.Report(true)
+	assert.False(t, bad.Ejected())
+	assert.Len(t, pool.available(), 2)
+
+	// ejection state survives refresh
+	bad.Report(false)
+	bad.Report(false)
+	registry.doRefresh()
+	assert.Len(t, registry.serviceDirectory["A"].available(), 1)
+	assert.True(t, registry.List()[0].Ejected)
+}
+
+func TestOutlierConcurrentProbe(t *testing.T) {
+	remotes := map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3101},
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3102},
+		},
+	}
+	t.Setenv(variables.OutlierDetectionEnabled, "true")
+	t.Setenv(variables.OutlierConsecutiveErrors, "1")
+	t.Setenv(variables.OutlierBaseEjectionTime, "10s")
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	now := time.Now()
+	registry.outlierDetector.now = func() time.Time { return now }
+	registry.doRefresh()
+
+	bad := registry.serviceDirectory["A"].instances[0]
+	bad.Report(false)
+	now = now.Add(10 * time.Second)
+
+	// half-open instance gets single trial request, the rest go to other instance
+	var probes atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance, err := registry.Get("A", Hint{Instance: bad.Id()})
+			if assert.NoError(t, err) && instance == bad {
+				probes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), probes.Load())
+
+	assert.False(t, bad.inRotation())
+
+	// lost trial request: probe can be claimed again, but only once
+	now = now.Add(10 * time.Second)
+	assert.True(t, bad.inRotation())
+	assert.True(t, registry.outlierDetector.selected(bad))
+	assert.False(t, registry.outlierDetector.selected(bad))
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/slink-go/api-gateway/discovery"
 	"github.com/slink-go/logging"
 	"github.com/slink-go/util/env"
+	"net/http"
 	"os"
 	"os/signal"
 	"slices"
@@ -15,20 +16,31 @@ import (
 )
 
 type serviceRegistry struct {
-	serviceDirectory *ringBuffers // TODO: при обновлении собьётся ringBuffer; можно ли что-то с этим сделать? стоит ли это делать? [UPD: shuffle ring buffer?]
+	serviceDirectory map[string]*servicePool
 	clients          []discovery.Client
+	strategy         string            // default load balancing strategy
+	strategies       map[string]string // service -> custom load balancing strategy
+	healthChecker    *healthChecker
+	outlierDetector  *outlierDetector
+	transports       Transports // nil - default transport
 	mutex            sync.RWMutex
 	logger           logging.Logger
 	sigChn           chan os.Signal
 }
 
+type servicePool struct {
+	instances []*Instance
+	strategy  Strategy
+}
+
 func NewServiceRegistry(clients ...discovery.Client) ServiceRegistry {
 	registry := serviceRegistry{
-		serviceDirectory: nil,
+		serviceDirectory: make(map[string]*servicePool),
 		clients:          clients,
 		logger:           logging.GetLogger("discovery-registry"),
 		sigChn:           make(chan os.Signal),
 	}
+	registry.strategy, registry.strategies = registry.strategiesConfig()
 
 	signal.Notify(registry.sigChn, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 
@@ -43,6 +55,19 @@ func NewServiceRegistry(clients ...discovery.Client) ServiceRegistry {
 		}
 	}
 
+	if env.BoolOrDefault(variables.OutlierDetectionEnabled, false) {
+		registry.outlierDetector = newOutlierDetector(&registry)
+	}
+	if env.BoolOrDefault(variables.HealthCheckEnabled, false) {
+		checker, err := newHealthChecker(&registry)
+		if err != nil {
+			registry.logger.Warning("health check disabled: %s", err)
+		} else {
+			registry.healthChecker = checker
+			go checker.run()
+		}
+	}
+
 	go registry.refresh()
 
 	return &registry
@@ -58,6 +83,7 @@ func (sr *serviceRegistry) refresh() {
 			timer.Stop()
 			return
 		case <-timer.C:
+			sr.doRefresh()
 		}
 		timer.Reset(interval)
 	}
@@ -65,23 +91,44 @@ func (sr *serviceRegistry) refresh() {
 
 func (sr *serviceRegistry) doRefresh() {
 	remotes := make(map[string]map[string]discovery.Remote)
-	directory := createRingBuffers()
 	for _, client := range sr.clients {
 		if client == nil {
 			continue
 		}
 		sr.getRemotes(remotes, client)
 	}
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	directory := make(map[string]*servicePool)
 	for k, list := range sr.filterRemotes(remotes) {
-		directory.New(k, len(list))
-		for _, url := range list {
-			v := url
-			directory.Set(k, &v)
+		// keep balancer state and in-flight request counters of instances which are still there
+		previous := make(map[string]*Instance)
+		pool, ok := sr.serviceDirectory[k]
+		if ok {
+			for _, instance := range pool.instances {
+				previous[instance.String()] = instance
+			}
+		} else {
+			pool = &servicePool{strategy: sr.newStrategy(k)}
+		}
+		instances := make([]*Instance, 0, len(list))
+		for _, remote := range list {
+			instance := newInstance(remote, previous[remote.String()])
+			instance.detector = sr.outlierDetector
+			instances = append(instances, instance)
+		}
+		slices.SortFunc(instances, func(a, b *Instance) int {
+			return a.Compare(b.Remote)
+		})
+		if ps, ok := pool.strategy.(PoolStrategy); ok {
+			ps.Update(instances)
+		}
+		directory[k] = &servicePool{
+			instances: instances,
+			strategy:  pool.strategy,
 		}
 	}
-	sr.mutex.Lock()
 	sr.serviceDirectory = directory
-	sr.mutex.Unlock()
 }
 func (sr *serviceRegistry) getRemotes(destination map[string]map[string]discovery.Remote, client discovery.Client) {
 	for _, instance := range client.Services().List() {
@@ -110,22 +157,150 @@ func (sr *serviceRegistry) filterRemotes(source map[string]map[string]discovery.
 	return remotes
 }
 
-func (sr *serviceRegistry) Get(serviceName string) (string, error) {
+func (sr *serviceRegistry) Get(serviceName string, hint Hint) (*Instance, error) {
 	sr.mutex.RLock()
 	defer sr.mutex.RUnlock()
-	v, ok := sr.serviceDirectory.Next(serviceName)
+	pool, ok := sr.serviceDirectory[serviceName]
 	if !ok {
-		return "", NewErrServiceUnavailable(serviceName)
+		return nil, NewErrServiceUnavailable(serviceName)
+	}
+	instances := pool.available()
+	if len(hint.Exclude) > 0 || hint.Version != "" {
+		instances = slices.DeleteFunc(slices.Clone(instances), func(instance *Instance) bool {
+			return slices.Contains(hint.Exclude, instance.Id()) || hint.Version != "" && instance.Version != hint.Version
+		})
+	}
+	for len(instances) > 0 {
+		instance := sr.choose(pool, instances, hint)
+		if sr.outlierDetector == nil || hint.DryRun || sr.outlierDetector.selected(instance) {
+			return instance, nil
+		}
+		// trial request of half-open instance is claimed by concurrent request
+		instances = slices.DeleteFunc(slices.Clone(instances), func(v *Instance) bool {
+			return v == instance
+		})
+	}
+	return nil, NewErrServiceUnavailable(serviceName)
+}
+func (sr *serviceRegistry) choose(pool *servicePool, instances []*Instance, hint Hint) *Instance {
+	if hint.Instance != "" {
+		for _, instance := range instances {
+			if instance.Id() == hint.Instance {
+				return instance
+			}
+		}
+	}
+	if hs, ok := pool.strategy.(HashStrategy); ok && hint.HashKey != "" {
+		return hs.NextFor(instances, hint.HashKey)
+	}
+	if ps, ok := pool.strategy.(PeekStrategy); ok && hint.DryRun {
+		return ps.Peek(instances)
+	}
+	return pool.strategy.Next(instances)
+}
+func (sr *serviceRegistry) List() []InstanceStatus {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+	result := make([]InstanceStatus, 0)
+	for _, pool := range sr.serviceDirectory {
+		for _, instance := range pool.instances {
+			status := InstanceStatus{
+				Remote:      instance.Remote,
+				Health:      HealthUnknown,
+				Outstanding: instance.Outstanding(),
+				Ejected:     instance.Ejected(),
+			}
+			if !instance.Healthy() {
+				status.Health = HealthUnhealthy
+			} else if sr.healthChecker != nil && instance.healthChecked() {
+				status.Health = HealthHealthy
+			}
+			result = append(result, status)
+		}
+	}
+	slices.SortFunc(result, func(a, b InstanceStatus) int {
+		return a.Compare(b.Remote)
+	})
+	return result
+}
+
+// UseTransports sets transports for registry requests to instances (health checks)
+func (sr *serviceRegistry) UseTransports(transports Transports) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.transports = transports
+}
+
+// transport returns transport for registry requests to instance
+func (sr *serviceRegistry) transport(instance *Instance) http.RoundTripper {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+	if sr.transports == nil {
+		return http.DefaultTransport
 	}
-	url := v.Next().Value.(*discovery.Remote)
-	return (*url).String(), nil
+	return sr.transports.Get(instance.App, instance.Meta)
 }
-func (sr *serviceRegistry) List() []discovery.Remote {
-	result := make([]discovery.Remote, 0)
-	for _, v := range sr.serviceDirectory.List() {
-		vv := v.(*discovery.Remote)
-		result = append(result, *vv)
+
+// instances returns current registry instances by service
+func (sr *serviceRegistry) instances() map[string][]*Instance {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+	result := make(map[string][]*Instance, len(sr.serviceDirectory))
+	for service, pool := range sr.serviceDirectory {
+		result[service] = pool.instances
 	}
-	slices.SortFunc(result, discovery.Remote.Compare)
 	return result
 }
+
+// available returns instances which are in load balancing rotation:
+// healthy and not ejected by outlier detection (or ready for trial request)
+func (p *servicePool) available() []*Instance {
+	for i, instance := range p.instances {
+		if instance.inRotation() {
+			continue
+		}
+		// (rare) slow path: some instances are out of rotation
+		result := make([]*Instance, 0, len(p.instances)-1)
+		result = append(result, p.instances[:i]...)
+		for _, instance := range p.instances[i+1:] {
+			if instance.inRotation() {
+				result = append(result, instance)
+			}
+		}
+		return result
+	}
+	return p.instances
+}
+
+// strategiesConfig reads default and per-service load balancing strategies;
+// per-service config format: "{service}:{strategy},..."
+func (sr *serviceRegistry) strategiesConfig() (string, map[string]string) {
+	strategy := env.StringOrDefault(variables.LoadBalancingStrategy, StrategyRoundRobin)
+	if _, err := NewStrategy(strategy); err != nil {
+		sr.logger.Warning("%s; use %s", err, StrategyRoundRobin)
+		strategy = StrategyRoundRobin
+	}
+	custom := make(map[string]string)
+	for _, item := range env.StringArrayOrEmpty(variables.LoadBalancingStrategyCustom) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			sr.logger.Warning("invalid custom load balancing strategy config '%s'", item)
+			continue
+		}
+		if _, err := NewStrategy(parts[1]); err != nil {
+			sr.logger.Warning("service %s: %s", parts[0], err)
+			continue
+		}
+		custom[strings.ToUpper(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+	return strategy, custom
+}
+func (sr *serviceRegistry) newStrategy(serviceName string) Strategy {
+	name, ok := sr.strategies[serviceName]
+	if !ok {
+		name = sr.strategy
+	}
+	strategy, _ := NewStrategy(name) // strategy names are validated on registry creation
+	sr.logger.Debug("%s: use %s load balancing", serviceName, name)
+	return strategy
+}
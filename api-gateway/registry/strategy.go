@@ -0,0 +1,307 @@
+package registry
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	StrategyRoundRobin         = "round-robin"
+	StrategyRandom             = "random"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastRequest       = "least-request"
+	StrategyPowerOfTwoChoices  = "p2c"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// Strategy selects service instance for the next request; strategy object is created per service
+// and may keep its own state between calls (instances list is never empty)
+type Strategy interface {
+	Next(instances []*Instance) *Instance
+}
+
+// HashStrategy selects service instance using request hash key
+// (Next is used for requests without key)
+type HashStrategy interface {
+	Strategy
+	NextFor(instances []*Instance, key string) *Instance
+}
+
+// PeekStrategy reports instance which would be selected for the next request without
+// changing strategy state (used for dry-run selection, e.g. request explanation);
+// strategies keeping state between calls should implement it, stateless strategies' Next is used as is
+type PeekStrategy interface {
+	Strategy
+	Peek(instances []*Instance) *Instance
+}
+
+// PoolStrategy is notified on service pool changes (registry refresh), so it can prepare
+// selection state once instead of on every request
+type PoolStrategy interface {
+	Strategy
+	Update(instances []*Instance)
+}
+
+type StrategyFactory func() Strategy
+
+var strategiesMutex sync.RWMutex
+var strategies = map[string]StrategyFactory{
+	StrategyRoundRobin:         func() Strategy { return &roundRobinStrategy{} },
+	StrategyRandom:             func() Strategy { return &randomStrategy{} },
+	StrategyWeightedRoundRobin: func() Strategy { return &weightedRoundRobinStrategy{current: make(map[string]int)} },
+	StrategyLeastRequest:       func() Strategy { return &leastRequestStrategy{} },
+	StrategyPowerOfTwoChoices:  func() Strategy { return &powerOfTwoChoicesStrategy{} },
+	StrategyConsistentHash:     func() Strategy { return &consistentHashStrategy{} },
+}
+
+// RegisterStrategy adds custom load balancing strategy (or replaces built-in one)
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMutex.Lock()
+	defer strategiesMutex.Unlock()
+	strategies[strings.ToLower(name)] = factory
+}
+
+func NewStrategy(name string) (Strategy, error) {
+	strategiesMutex.RLock()
+	defer strategiesMutex.RUnlock()
+	factory, ok := strategies[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown load balancing strategy: '%s'", name)
+	}
+	return factory(), nil
+}
+
+// region - round-robin
+
+type roundRobinStrategy struct {
+	counter atomic.Uint64
+}
+
+func (s *roundRobinStrategy) Next(instances []*Instance) *Instance {
+	return instances[(s.counter.Add(1)-1)%uint64(len(instances))]
+}
+func (s *roundRobinStrategy) Peek(instances []*Instance) *Instance {
+	return instances[s.counter.Load()%uint64(len(instances))]
+}
+
+// endregion
+// region - random
+
+type randomStrategy struct {
+}
+
+func (s *randomStrategy) Next(instances []*Instance) *Instance {
+	return instances[rand.IntN(len(instances))]
+}
+
+// endregion
+// region - weighted round-robin
+
+// weightedRoundRobinStrategy implements "smooth" weighted round-robin (as in nginx):
+// instances are interleaved instead of being picked in weight-sized bursts
+type weightedRoundRobinStrategy struct {
+	mutex   sync.Mutex
+	current map[string]int // instance -> current weight
+}
+
+func (s *weightedRoundRobinStrategy) Next(instances []*Instance) *Instance {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.current) > len(instances) {
+		// some instances are gone; drop their state
+		current := make(map[string]int, len(instances))
+		for _, instance := range instances {
+			current[instance.String()] = s.current[instance.String()]
+		}
+		s.current = current
+	}
+	var best *Instance
+	total := 0
+	for _, instance := range instances {
+		weight := instance.EffectiveWeight()
+		total += weight
+		s.current[instance.String()] += weight
+		if best == nil || s.current[instance.String()] > s.current[best.String()] {
+			best = instance
+		}
+	}
+	s.current[best.String()] -= total
+	return best
+}
+func (s *weightedRoundRobinStrategy) Peek(instances []*Instance) *Instance {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var best *Instance
+	bestCurrent := 0
+	for _, instance := range instances {
+		current := s.current[instance.String()] + instance.EffectiveWeight()
+		if best == nil || current > bestCurrent {
+			best, bestCurrent = instance, current
+		}
+	}
+	return best
+}
+
+// endregion
+// region - least outstanding requests
+
+// leastRequestStrategy picks instance with the lowest number of requests in flight
+// (relative to its weight); ties are broken randomly
+type leastRequestStrategy struct {
+}
+
+func (s *leastRequestStrategy) Next(instances []*Instance) *Instance {
+	var best []*Instance
+	var bestLoad float64
+	for _, instance := range instances {
+		load := instanceLoad(instance)
+		switch {
+		case len(best) == 0 || load < bestLoad:
+			best = append(best[:0], instance)
+			bestLoad = load
+		case load == bestLoad:
+			best = append(best, instance)
+		}
+	}
+	return best[rand.IntN(len(best))]
+}
+
+// endregion
+// region - power of two choices
+
+// powerOfTwoChoicesStrategy picks two random instances and uses less loaded one
+type powerOfTwoChoicesStrategy struct {
+}
+
+func (s *powerOfTwoChoicesStrategy) Next(instances []*Instance) *Instance {
+	if len(instances) == 1 {
+		return instances[0]
+	}
+	i := rand.IntN(len(instances))
+	j := rand.IntN(len(instances) - 1)
+	if j >= i {
+		j++
+	}
+	if instanceLoad(instances[j]) < instanceLoad(instances[i]) {
+		return instances[j]
+	}
+	return instances[i]
+}
+
+// endregion
+// region - consistent hash
+
+// replicas per unit of instance weight on consistent hash ring
+const hashRingReplicas = 160
+
+// consistentHashStrategy maps request keys to instances using consistent hash ring, so only keys
+// of added/removed instance are moved; requests without key are balanced round-robin. Ring is built
+// over the whole service pool on registry refresh; instances which can not be selected (excluded,
+// of another version, ejected) are skipped clockwise, so their keys are moved to the next owners only
+type consistentHashStrategy struct {
+	roundRobinStrategy
+	ring atomic.Pointer[hashRing]
+}
+
+type hashRing struct {
+	signature string
+	points    []uint64
+	owners    []int       // ring point -> instance index
+	instances []*Instance // service pool
+}
+
+// Update rebuilds hash ring if pool instances or weights are changed
+func (s *consistentHashStrategy) Update(instances []*Instance) {
+	signature := hashRingSignature(instances)
+	ring := s.ring.Load()
+	if ring == nil || ring.signature != signature {
+		ring = newHashRing(instances)
+		ring.signature = signature
+	} else {
+		// same instances (sorted), but new registry objects
+		ring = &hashRing{signature: signature, points: ring.points, owners: ring.owners, instances: instances}
+	}
+	s.ring.Store(ring)
+}
+
+func (s *consistentHashStrategy) NextFor(instances []*Instance, key string) *Instance {
+	ring := s.ring.Load()
+	if ring == nil || len(ring.points) == 0 {
+		return s.Next(instances)
+	}
+	i, _ := slices.BinarySearch(ring.points, hashOf(key))
+	for n := 0; n < len(ring.points); n++ {
+		owner := ring.instances[ring.owners[(i+n)%len(ring.points)]]
+		if slices.Contains(instances, owner) {
+			return owner
+		}
+	}
+	// instances are not in the pool
+	return s.Next(instances)
+}
+
+func newHashRing(instances []*Instance) *hashRing {
+	type point struct {
+		hash  uint64
+		owner int
+	}
+	var points []point
+	for i, instance := range instances {
+		for r := 0; r < hashRingReplicas*instance.EffectiveWeight(); r++ {
+			points = append(points, point{hashOf(instance.String() + "#" + strconv.Itoa(r)), i})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+	ring := hashRing{
+		points:    make([]uint64, len(points)),
+		owners:    make([]int, len(points)),
+		instances: instances,
+	}
+	for i, p := range points {
+		ring.points[i] = p.hash
+		ring.owners[i] = p.owner
+	}
+	return &ring
+}
+func hashRingSignature(instances []*Instance) string {
+	var sb strings.Builder
+	for _, instance := range instances {
+		sb.WriteString(instance.String())
+		sb.WriteString("#")
+		sb.WriteString(strconv.Itoa(instance.EffectiveWeight()))
+		sb.WriteString(";")
+	}
+	return sb.String()
+}
+func hashOf(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	// fnv has poor avalanche on similar short inputs; finalize with splitmix64 mixer
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// endregion
+
+func instanceLoad(instance *Instance) float64 {
+	return float64(instance.Outstanding()+1) / float64(instance.EffectiveWeight())
+}
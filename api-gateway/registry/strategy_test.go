@@ -0,0 +1,222 @@
+package registry
+
+import (
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func testInstances(weights ...int) []*Instance {
+	var result []*Instance
+	for i, w := range weights {
+		result = append(result, newInstance(discovery.Remote{
+			App:    "A",
+			Scheme: "http",
+			Host:   "service-a",
+			Port:   3101 + i,
+			Weight: w,
+		}, nil))
+	}
+	return result
+}
+
+func pick(t *testing.T, name string, instances []*Instance, count int) map[int]int {
+	strategy, err := NewStrategy(name)
+	assert.NoError(t, err)
+	result := make(map[int]int)
+	for i := 0; i < count; i++ {
+		result[strategy.Next(instances).Port]++
+	}
+	return result
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	instances := testInstances(0, 0, 0)
+	assert.Equal(t, map[int]int{3101: 2, 3102: 2, 3103: 2}, pick(t, StrategyRoundRobin, instances, 6))
+}
+
+func TestWeightedRoundRobinStrategy(t *testing.T) {
+	instances := testInstances(5, 1, 1)
+	assert.Equal(t, map[int]int{3101: 10, 3102: 2, 3103: 2}, pick(t, StrategyWeightedRoundRobin, instances, 14))
+
+	// smooth: heavy instance is interleaved with others, not picked 5 times in a row
+	strategy, _ := NewStrategy(StrategyWeightedRoundRobin)
+	var sequence []int
+	for i := 0; i < 7; i++ {
+		sequence = append(sequence, strategy.Next(instances).Port)
+	}
+	assert.Equal(t, []int{3101, 3101, 3102, 3101, 3103, 3101, 3101}, sequence)
+}
+
+func TestPeekStrategy(t *testing.T) {
+	for _, name := range []string{StrategyRoundRobin, StrategyWeightedRoundRobin, StrategyConsistentHash} {
+		instances := testInstances(3, 1, 2)
+		strategy, _ := NewStrategy(name)
+		ps, ok := strategy.(PeekStrategy)
+		if !assert.True(t, ok, name) {
+			continue
+		}
+		for i := 0; i < 10; i++ {
+			peeked := ps.Peek(instances)
+			assert.Same(t, peeked, ps.Peek(instances), name)
+			assert.Same(t, peeked, strategy.Next(instances), name)
+		}
+	}
+}
+
+func TestDryRunSelection(t *testing.T) {
+	remotes := map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3101},
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3102},
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3103},
+		},
+	}
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	registry.doRefresh()
+
+	// dry run (e.g. request explanation) does not shift round-robin
+	_, _ = registry.Get("A", Hint{})
+	for i := 0; i < 5; i++ {
+		explained, err := registry.Get("A", Hint{DryRun: true})
+		assert.NoError(t, err)
+		next, err := registry.Get("A", Hint{})
+		assert.NoError(t, err)
+		assert.Same(t, explained, next)
+	}
+}
+
+func TestLeastRequestStrategy(t *testing.T) {
+	instances := testInstances(0, 0, 0)
+	instances[0].Begin()
+	instances[1].Begin()
+	instances[1].Begin()
+	assert.Equal(t, map[int]int{3103: 10}, pick(t, StrategyLeastRequest, instances, 10))
+
+	instances[2].Begin()
+	instances[2].Begin()
+	assert.Equal(t, map[int]int{3101: 10}, pick(t, StrategyLeastRequest, instances, 10))
+
+	instances[1].End()
+	instances[1].End()
+	assert.Equal(t, map[int]int{3102: 10}, pick(t, StrategyLeastRequest, instances, 10))
+}
+
+func TestPowerOfTwoChoicesStrategy(t *testing.T) {
+	instances := testInstances(0, 0)
+	instances[0].Begin()
+	assert.Equal(t, map[int]int{3102: 10}, pick(t, StrategyPowerOfTwoChoices, instances, 10))
+
+	// the most loaded instance is never chosen
+	instances = testInstances(0, 0, 0)
+	for i := 0; i < 5; i++ {
+		instances[1].Begin()
+	}
+	assert.Zero(t, pick(t, StrategyPowerOfTwoChoices, instances, 100)[3102])
+}
+
+func TestRandomStrategy(t *testing.T) {
+	instances := testInstances(0, 0)
+	result := pick(t, StrategyRandom, instances, 100)
+	assert.Equal(t, 100, result[3101]+result[3102])
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	_, err := NewStrategy("unknown")
+	assert.Error(t, err)
+}
+
+func TestInstanceStateSurvivesRefresh(t *testing.T) {
+	remotes := map[string][]discovery.Remote{
+		"A": {{App: "A", Scheme: "http", Host: "service-a", Port: 3101}},
+	}
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	registry.doRefresh()
+
+	instance, err := registry.Get("A", Hint{})
+	assert.NoError(t, err)
+	instance.Begin()
+
+	registry.doRefresh()
+	instance, err = registry.Get("A", Hint{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), instance.Outstanding())
+
+	_, err = registry.Get("B", Hint{})
+	assert.ErrorIs(t, err, NewErrServiceUnavailable("B"))
+}
+
+func TestConsistentHashStrategy(t *testing.T) {
+	strategy, err := NewStrategy(StrategyConsistentHash)
+	assert.NoError(t, err)
+	hs, ok := strategy.(HashStrategy)
+	assert.True(t, ok)
+
+	instances := testInstances(0, 0, 0, 0)
+	strategy.(PoolStrategy).Update(instances)
+	before := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		before[key] = hs.NextFor(instances, key).Port
+		assert.Equal(t, before[key], hs.NextFor(instances, key).Port)
+	}
+
+	// only keys of removed instance are moved
+	moved := 0
+	for key, port := range before {
+		if port == 3104 {
+			continue
+		}
+		if hs.NextFor(instances[:3], key).Port != port {
+			moved++
+		}
+	}
+	assert.Zero(t, moved)
+
+	// ring is not rebuilt for subsets: alternating subsets do not remap keys
+	ring := strategy.(*consistentHashStrategy).ring.Load()
+	for key, port := range before {
+		if port != 3101 {
+			assert.Equal(t, port, hs.NextFor(instances[1:], key).Port)
+			assert.Equal(t, port, hs.NextFor(instances, key).Port)
+		}
+	}
+	assert.Same(t, ring, strategy.(*consistentHashStrategy).ring.Load())
+
+	// new instance takes only a fraction of keys
+	moved = 0
+	extended := append(testInstances(0, 0, 0, 0), testInstances(0, 0, 0, 0, 0)[4])
+	strategy.(PoolStrategy).Update(extended)
+	for key, port := range before {
+		if hs.NextFor(extended, key).Port != port {
+			moved++
+		}
+	}
+	assert.Less(t, moved, 300)
+	assert.Greater(t, moved, 100)
+}
+
+func TestStickyInstanceHint(t *testing.T) {
+	remotes := map[string][]discovery.Remote{
+		"A": {
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3101},
+			{App: "A", Scheme: "http", Host: "service-a", Port: 3102},
+		},
+	}
+	registry := NewServiceRegistry(discovery.NewStaticClient(remotes)).(*serviceRegistry)
+	registry.doRefresh()
+
+	pinned, err := registry.Get("A", Hint{})
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		instance, err := registry.Get("A", Hint{Instance: pinned.Id()})
+		assert.NoError(t, err)
+		assert.Equal(t, pinned.Port, instance.Port)
+	}
+
+	// unknown (e.g. removed) instance is ignored
+	instance, err := registry.Get("A", Hint{Instance: "unknown"})
+	assert.NoError(t, err)
+	assert.NotNil(t, instance)
+}
@@ -40,3 +40,21 @@ func NewErrEmptyBaseUrl() error {
 		message: "empty base url",
 	}
 }
+
+type ErrUnknownTrafficSplit struct {
+	message string
+}
+
+func (err *ErrUnknownTrafficSplit) Error() string {
+	return err.message
+}
+func (err *ErrUnknownTrafficSplit) Is(other error) bool {
+	var errRef *ErrUnknownTrafficSplit
+	return errors.As(other, &errRef)
+}
+
+func NewErrUnknownTrafficSplit(service string) error {
+	return &ErrUnknownTrafficSplit{
+		message: fmt.Sprintf("no traffic split for service: %s", service),
+	}
+}
@@ -0,0 +1,214 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slink-go/api-gateway/registry"
+	"gopkg.in/yaml.v3"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FallbackConfig configures fallbacks: default fallback is used for requests which
+// could not be matched to any service, service fallbacks - when service has no available instances
+type FallbackConfig struct {
+	Default  *Fallback           `json:"default,omitempty" yaml:"default,omitempty"`
+	Services map[string]Fallback `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+// Fallback is a fallback service (request path is kept), and / or static response
+// (used if fallback service is not set or is not available too)
+type Fallback struct {
+	Service  string            `json:"service,omitempty" yaml:"service,omitempty"`
+	Response *FallbackResponse `json:"response,omitempty" yaml:"response,omitempty"`
+}
+
+type FallbackResponse struct {
+	Status   int               `json:"status,omitempty" yaml:"status,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	BodyFile string            `json:"body-file,omitempty" yaml:"body-file,omitempty"` // relative to config file directory
+	body     []byte
+}
+
+type Fallbacks struct {
+	defaultFallback *Fallback
+	services        map[string]Fallback
+}
+
+// NewFallbacks validates fallback config and loads static response bodies
+// (relative body file paths are resolved against baseDir)
+func NewFallbacks(config FallbackConfig, baseDir string) (*Fallbacks, error) {
+	result := Fallbacks{
+		services: make(map[string]Fallback, len(config.Services)),
+	}
+	if config.Default != nil {
+		fallback := *config.Default
+		if err := fallback.init(http.StatusNotFound, baseDir); err != nil {
+			return nil, fmt.Errorf("default fallback: %w", err)
+		}
+		result.defaultFallback = &fallback
+	}
+	for service, fallback := range config.Services {
+		service = strings.ToUpper(strings.TrimSpace(service))
+		if _, ok := result.services[service]; ok {
+			return nil, fmt.Errorf("duplicate fallback for %s", service)
+		}
+		if err := fallback.init(http.StatusServiceUnavailable, baseDir); err != nil {
+			return nil, fmt.Errorf("%s fallback: %w", service, err)
+		}
+		if strings.EqualFold(fallback.Service, service) {
+			return nil, fmt.Errorf("%s fallback: service falls back to itself", service)
+		}
+		result.services[service] = fallback
+	}
+	return &result, nil
+}
+
+// LoadFallbacks reads fallback config from YAML or JSON file
+func LoadFallbacks(path string) (*Fallbacks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config FallbackConfig
+	if strings.HasSuffix(path, "yml") || strings.HasSuffix(path, "yaml") {
+		err = yaml.Unmarshal(data, &config)
+	} else if strings.HasSuffix(path, "json") {
+		err = json.Unmarshal(data, &config)
+	} else {
+		err = fmt.Errorf("unsupported file type: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewFallbacks(config, filepath.Dir(path))
+}
+
+func (f *Fallback) init(status int, baseDir string) error {
+	f.Service = strings.ToUpper(strings.TrimSpace(f.Service))
+	if f.Service == "" && f.Response == nil {
+		return fmt.Errorf("neither service nor response set")
+	}
+	if f.Response == nil {
+		return nil
+	}
+	response := *f.Response
+	if response.Status == 0 {
+		response.Status = status
+	}
+	if response.Status < 100 || response.Status > 999 {
+		return fmt.Errorf("invalid response status %d", response.Status)
+	}
+	if response.BodyFile != "" {
+		path := response.BodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		response.body = body
+	}
+	f.Response = &response
+	return nil
+}
+
+// Resolver returns service resolver which resolves fallback service instead of
+// service without available instances
+func (f *Fallbacks) Resolver(next ServiceResolver) ServiceResolver {
+	return &fallbackResolver{
+		fallbacks: f,
+		next:      next,
+	}
+}
+
+// TargetResolve handles target resolution error: unmatched request is resolved to default
+// fallback service, static fallback response is returned if configured for the error;
+// otherwise original error is returned
+func (f *Fallbacks) TargetResolve(request *http.Request, cause error, resolver ServiceResolver, hint HintFunc) (*Target, error) {
+	var unavailable *registry.ErrServiceUnavailable
+	switch {
+	case errors.As(cause, &unavailable):
+		// fallback service (if any) has already been tried by fallback resolver
+		fallback, ok := f.services[strings.ToUpper(unavailable.Service())]
+		if !ok || fallback.Response == nil {
+			return nil, cause
+		}
+		return &Target{
+			Service:  unavailable.Service(),
+			Response: fallback.Response,
+		}, nil
+	case errors.Is(cause, NewErrInvalidPath("")) || errors.Is(cause, NewErrEmptyBaseUrl()):
+		if f.defaultFallback == nil {
+			return nil, cause
+		}
+		if f.defaultFallback.Service != "" {
+			var h registry.Hint
+			if hint != nil {
+				h = hint(f.defaultFallback.Service)
+			}
+			instance, err := resolver.Resolve(f.defaultFallback.Service, h)
+			if err == nil && instance != nil {
+				return &Target{
+					Service:  f.defaultFallback.Service,
+					Instance: instance,
+					Url:      instance.String() + request.URL.EscapedPath(),
+				}, nil
+			}
+			if f.defaultFallback.Response == nil {
+				return nil, registry.NewErrServiceUnavailable(f.defaultFallback.Service)
+			}
+		}
+		return &Target{
+			Response: f.defaultFallback.Response,
+		}, nil
+	default:
+		return nil, cause
+	}
+}
+
+// Write writes static fallback response
+func (r *FallbackResponse) Write(w http.ResponseWriter) {
+	for name, value := range r.Headers {
+		w.Header().Set(name, value)
+	}
+	if len(r.body) > 0 && w.Header().Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(r.BodyFile))
+		if contentType == "" {
+			contentType = http.DetectContentType(r.body)
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(r.Status)
+	_, _ = w.Write(r.body)
+}
+
+// region - resolver
+
+type fallbackResolver struct {
+	fallbacks *Fallbacks
+	next      ServiceResolver
+}
+
+func (r *fallbackResolver) Resolve(serviceName string, hint registry.Hint) (*registry.Instance, error) {
+	instance, err := r.next.Resolve(serviceName, hint)
+	if err == nil || !errors.Is(err, registry.NewErrServiceUnavailable(serviceName)) {
+		return instance, err
+	}
+	fallback, ok := r.fallbacks.services[strings.ToUpper(serviceName)]
+	if ok && fallback.Service != "" {
+		// instance pinning and exclusions are not applicable to fallback service
+		if instance, err = r.next.Resolve(fallback.Service, registry.Hint{HashKey: hint.HashKey, DryRun: hint.DryRun}); err == nil {
+			return instance, nil
+		}
+	}
+	// report unavailability of the requested service, so its static fallback response can be used
+	return nil, registry.NewErrServiceUnavailable(serviceName)
+}
+
+// endregion
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFallbacks(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "maintenance.html"), []byte("<h1>maintenance</h1>"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fallbacks.yml"), []byte(`
+default:
+  service: default-service
+services:
+  service-a:
+    service: service-a-backup
+  service-b:
+    service: service-c
+    response:
+      headers: { Retry-After: "30" }
+      body-file: maintenance.html
+`), 0o644))
+	fallbacks, err := LoadFallbacks(filepath.Join(dir, "fallbacks.yml"))
+	assert.NoError(t, err)
+
+	next := staticResolver{
+		"SERVICE-A-BACKUP": {Scheme: "http", Host: "a-backup", Port: 8081},
+		"DEFAULT-SERVICE":  {Scheme: "http", Host: "default", Port: 8080},
+	}
+	pathProcessor := NewPathProcessor()
+	resolve := func(path string) (*Target, error) {
+		request := httptest.NewRequest("GET", path, nil)
+		serviceResolver := fallbacks.Resolver(next)
+		target, err := pathProcessor.TargetResolve(request.URL.Path, serviceResolver, nil)
+		if err != nil {
+			return fallbacks.TargetResolve(request, err, serviceResolver, nil)
+		}
+		return target, err
+	}
+
+	// fallback service
+	target, err := resolve("/api/service-a/items")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://a-backup:8081/api/items", target.Url)
+		assert.Nil(t, target.Response)
+	}
+
+	// fallback service is not available too: static response
+	target, err = resolve("/service-b/items")
+	if assert.NoError(t, err) && assert.NotNil(t, target.Response) {
+		w := httptest.NewRecorder()
+		target.Response.Write(w)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "<h1>maintenance</h1>", w.Body.String())
+	}
+
+	// no fallback for service
+	_, err = resolve("/service-x/items")
+	assert.Error(t, err)
+
+	// unmatched path: default service
+	target, err = resolve("/")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://default:8080/", target.Url)
+	}
+	delete(next, "DEFAULT-SERVICE")
+	_, err = resolve("/")
+	assert.Error(t, err)
+}
+
+func TestFallbackValidation(t *testing.T) {
+	for name, config := range map[string]FallbackConfig{
+		"empty fallback":     {Default: &Fallback{}},
+		"invalid status":     {Default: &Fallback{Response: &FallbackResponse{Status: 42}}},
+		"missing body file":  {Services: map[string]Fallback{"a": {Response: &FallbackResponse{BodyFile: "missing.html"}}}},
+		"self fallback":      {Services: map[string]Fallback{"a": {Service: "A"}}},
+		"duplicate services": {Services: map[string]Fallback{"a": {Service: "B"}, "A ": {Service: "C"}}},
+	} {
+		_, err := NewFallbacks(config, t.TempDir())
+		assert.Error(t, err, name)
+	}
+	fallbacks, err := NewFallbacks(FallbackConfig{Default: &Fallback{Response: &FallbackResponse{}}}, "")
+	assert.NoError(t, err)
+	target, err := fallbacks.TargetResolve(httptest.NewRequest("GET", "/", nil), NewErrInvalidPath("/"), staticResolver{}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNotFound, target.Response.Status)
+	}
+}
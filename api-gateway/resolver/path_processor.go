@@ -3,60 +3,188 @@ package resolver
 import (
 	"fmt"
 	"github.com/slink-go/api-gateway/registry"
+	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 )
 
 type PathProcessor interface {
 	Split(input string) ([]string, error)
+	Prefix(input string) string
 	Join(serviceUrl string, parts []string) (string, error)
 	UrlResolve(input string, resolver ServiceResolver) (string, error)
 	HostResolve(input string, resolver ServiceResolver) (string, error)
+	TargetResolve(input string, resolver ServiceResolver, hint HintFunc) (*Target, error)
 }
 
-func NewPathProcessor() PathProcessor {
-	return &pathProcessor{}
+// HintFunc provides instance selection hint for resolved service name
+type HintFunc func(service string) registry.Hint
+
+// target resolution sources (see Target.Via)
+const (
+	ViaRoute       = "route"
+	ViaVirtualHost = "virtual-host"
+	ViaConvention  = "convention"
+	ViaFallback    = "fallback"
+)
+
+// Target is a resolved proxy target: service instance chosen by registry and
+// the full upstream URL for the request
+type Target struct {
+	Service  string
+	Instance *registry.Instance // nil for literal URL routes
+	Route    string             // matched route id (empty for convention-based resolution)
+	Via      string             // resolution source: route, virtual host, path convention or fallback
+	Url      string
+	Prefix   string            // request path prefix removed from upstream path (e.g. /api/service-a)
+	Headers  http.Header       // headers to add to upstream request (set by route filters)
+	Status   int               // upstream response status override (set by route filters)
+	Mirror   *Mirror           // route traffic mirroring
+	Response *FallbackResponse // static fallback response (request is not proxied)
+	Resolver ServiceResolver   // request service resolver (traffic splits, fallbacks), used for retries
+}
+
+// PathPrefixMode defines how recognized path prefix segment is forwarded to service
+type PathPrefixMode string
+
+const (
+	PathPrefixMove  PathPrefixMode = "move"  // moved behind service name: /api/service-a/items -> /api/items
+	PathPrefixKeep  PathPrefixMode = "keep"  // kept in place (with service name): /v1/service-a/items -> /v1/service-a/items
+	PathPrefixStrip PathPrefixMode = "strip" // removed: /internal/service-a/items -> /items
+)
+
+// PathPrefix is a path segment which may precede service name in request path
+type PathPrefix struct {
+	Segment string
+	Mode    PathPrefixMode
+}
+
+var defaultPathPrefixes = []PathPrefix{{Segment: "api", Mode: PathPrefixMove}}
+
+// ParsePathPrefixes parses list of "{segment}[:{mode}]" items (default mode is "move")
+func ParsePathPrefixes(items ...string) ([]PathPrefix, error) {
+	result := make([]PathPrefix, 0, len(items))
+	for _, item := range items {
+		segment, mode, _ := strings.Cut(item, ":")
+		prefix := PathPrefix{
+			Segment: strings.ToLower(strings.Trim(strings.TrimSpace(segment), "/")),
+			Mode:    PathPrefixMode(strings.ToLower(strings.TrimSpace(mode))),
+		}
+		if prefix.Mode == "" {
+			prefix.Mode = PathPrefixMove
+		}
+		if prefix.Segment == "" || strings.Contains(prefix.Segment, "/") {
+			return nil, fmt.Errorf("invalid path prefix '%s'", item)
+		}
+		switch prefix.Mode {
+		case PathPrefixMove, PathPrefixKeep, PathPrefixStrip:
+		default:
+			return nil, fmt.Errorf("invalid path prefix mode '%s'", item)
+		}
+		result = append(result, prefix)
+	}
+	return result, nil
+}
+
+func NewPathProcessor(options ...PathProcessorOption) PathProcessor {
+	pp := pathProcessor{}
+	for _, option := range options {
+		if option != nil {
+			option.apply(&pp)
+		}
+	}
+	return &pp
 }
 
 type pathProcessor struct {
+	prefixes     []PathPrefix // recognized prefix segments (nil - default "api" prefix)
+	preserveCase bool         // keep case of path segments (service name is always lower-cased)
+	strict       bool         // reject ambiguous paths
 }
 
+// Split splits request path (in escaped form, so encoded "/" does not split segments) into
+// service name and upstream path segments: [service, segment, ...]; leading prefix segments
+// are handled according to their modes
 func (pp *pathProcessor) Split(input string) ([]string, error) {
+	parts, _, err := pp.split(input)
+	return parts, err
+}
+
+// Prefix returns leading part of request path which is removed from upstream path: prefix segments
+// and service name (or prefix segments preceding kept ones); empty if path can not be split
+func (pp *pathProcessor) Prefix(input string) string {
+	_, prefix, err := pp.split(input)
+	if err != nil {
+		return ""
+	}
+	return prefix
+}
 
-	parts := strings.Split(
-		strings.TrimSuffix(
-			strings.TrimPrefix(
-				strings.ToLower(input),
-				"/",
-			),
-			"/",
-		),
-		"/",
-	)
+func (pp *pathProcessor) split(input string) ([]string, string, error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(input, "/"), "/")
+	original := strings.Split(path, "/")
+	if !pp.preserveCase {
+		path = strings.ToLower(path)
+	}
+	parts := strings.Split(path, "/")
 	if pp.partsIsEmpty(parts) {
-		return nil, NewErrInvalidPath(input)
+		return nil, "", NewErrInvalidPath(input)
+	}
+	if pp.strict && slices.Contains(parts, "") {
+		return nil, "", NewErrInvalidPath(input)
 	}
 
-	useApi := false
-	if parts[0] == "api" {
-		useApi = true
+	// leading prefix segments (each prefix is recognized once)
+	var kept, moved []string
+	consumed := 0  // number of leading prefix segments
+	stripped := -1 // number of leading segments removed from upstream path (-1 - all prefixes and service name)
+	used := make(map[string]struct{})
+	for len(parts) > 0 {
+		prefix, ok := pp.prefix(parts[0])
+		if _, seen := used[prefix.Segment]; !ok || seen {
+			break
+		}
+		used[prefix.Segment] = struct{}{}
+		switch prefix.Mode {
+		case PathPrefixKeep:
+			kept = append(kept, parts[0])
+			if stripped < 0 {
+				stripped = consumed
+			}
+		case PathPrefixMove:
+			moved = append(moved, parts[0])
+		}
 		parts = parts[1:]
+		consumed++
 	}
-
 	if len(parts) == 0 {
-		return nil, NewErrInvalidPath(input)
+		return nil, "", NewErrInvalidPath(input)
 	}
 
-	if useApi {
-		if len(parts) == 1 {
-			parts = append(parts, "api")
-		} else if parts[1] != "api" {
-			parts = append(parts[:2], parts[1:]...)
-			parts[1] = "api"
+	service, rest := parts[0], parts[1:]
+	if pp.strict {
+		// service name looks like a prefix, or moved prefix is repeated after service name
+		if _, ok := pp.prefix(service); ok || len(moved) > 0 && pp.hasPrefix(rest, moved) {
+			return nil, "", NewErrInvalidPath(input)
 		}
 	}
 
-	return parts, nil
+	result := []string{strings.ToLower(service)}
+	if len(kept) > 0 {
+		result = append(append(result, kept...), service)
+	}
+	if len(moved) > 0 && !pp.hasPrefix(rest, moved) {
+		result = append(result, moved...)
+	}
+	if stripped < 0 {
+		stripped = consumed + 1 // with service name
+	}
+	prefix := ""
+	if stripped > 0 {
+		prefix = "/" + strings.Join(original[:stripped], "/")
+	}
+	return append(result, rest...), prefix, nil
 }
 func (pp *pathProcessor) Join(serviceUrl string, parts []string) (string, error) {
 	if serviceUrl == "" {
@@ -72,35 +200,82 @@ func (pp *pathProcessor) HostResolve(input string, resolver ServiceResolver) (st
 	if err != nil {
 		return "", err
 	}
-	target, err := resolver.Resolve(parsed.Host)
+	target, err := resolver.Resolve(parsed.Host, registry.Hint{})
 	if err != nil {
 		return "", err
 	}
-	resolved := target + parsed.Path
+	resolved := target.String() + parsed.Path
 	return resolved, nil
 }
 func (pp *pathProcessor) UrlResolve(input string, resolver ServiceResolver) (string, error) {
-	parts, err := pp.Split(input)
+	target, err := pp.TargetResolve(input, resolver, nil)
 	if err != nil {
 		return "", err
 	}
+	return target.Url, nil
+}
+func (pp *pathProcessor) TargetResolve(input string, resolver ServiceResolver, hint HintFunc) (*Target, error) {
+	parts, prefix, err := pp.split(input)
+	if err != nil {
+		return nil, err
+	}
 
-	target, err := resolver.Resolve(parts[0])
+	var h registry.Hint
+	if hint != nil {
+		h = hint(parts[0])
+	}
+	instance, err := resolver.Resolve(parts[0], h)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if target == "" {
-		return "", registry.NewErrServiceUnavailable(parts[0])
+	if instance == nil {
+		return nil, registry.NewErrServiceUnavailable(parts[0])
 	}
 
-	url, err := pp.Join(target, parts)
+	url, err := pp.Join(instance.String(), parts)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	url = keepTrailingSlash(input, url)
 
-	return url, nil
+	return &Target{
+		Service:  parts[0],
+		Instance: instance,
+		Url:      url,
+		Prefix:   prefix,
+	}, nil
 }
 
+// keepTrailingSlash restores trailing slash of request path removed by path split
+func keepTrailingSlash(path, url string) string {
+	if strings.HasSuffix(path, "/") && !strings.HasSuffix(url, "/") {
+		return url + "/"
+	}
+	return url
+}
+func (pp *pathProcessor) prefix(segment string) (PathPrefix, bool) {
+	prefixes := pp.prefixes
+	if prefixes == nil {
+		prefixes = defaultPathPrefixes
+	}
+	for _, prefix := range prefixes {
+		if strings.EqualFold(prefix.Segment, segment) {
+			return prefix, true
+		}
+	}
+	return PathPrefix{}, false
+}
+func (pp *pathProcessor) hasPrefix(parts, prefix []string) bool {
+	if len(parts) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if !strings.EqualFold(parts[i], prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
 func (pp *pathProcessor) partsIsEmpty(parts []string) bool {
 	for _, part := range parts {
 		if part != "" {
@@ -109,3 +284,62 @@ func (pp *pathProcessor) partsIsEmpty(parts []string) bool {
 	}
 	return true
 }
+
+// region - options
+
+type PathProcessorOption interface {
+	apply(*pathProcessor)
+}
+
+// region -> prefixes
+
+func WithPathPrefixes(value ...PathPrefix) PathProcessorOption {
+	return &pathPrefixesOption{
+		value: value,
+	}
+}
+
+type pathPrefixesOption struct {
+	value []PathPrefix
+}
+
+func (o *pathPrefixesOption) apply(pp *pathProcessor) {
+	pp.prefixes = append([]PathPrefix{}, o.value...)
+}
+
+// endregion
+// region -> preserve case
+
+func WithPreserveCase(value bool) PathProcessorOption {
+	return &preserveCaseOption{
+		value: value,
+	}
+}
+
+type preserveCaseOption struct {
+	value bool
+}
+
+func (o *preserveCaseOption) apply(pp *pathProcessor) {
+	pp.preserveCase = o.value
+}
+
+// endregion
+// region -> strict
+
+func WithStrictPaths(value bool) PathProcessorOption {
+	return &strictPathsOption{
+		value: value,
+	}
+}
+
+type strictPathsOption struct {
+	value bool
+}
+
+func (o *strictPathsOption) apply(pp *pathProcessor) {
+	pp.strict = o.value
+}
+
+// endregion
+// endregion
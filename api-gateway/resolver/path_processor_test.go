@@ -5,6 +5,7 @@ import (
 	"github.com/slink-go/api-gateway/cmd/common/variables"
 	"github.com/slink-go/api-gateway/discovery"
 	"github.com/slink-go/api-gateway/registry"
+	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
 	"time"
@@ -125,6 +126,139 @@ func TestPartsSplit(t *testing.T) {
 		testPartsSplit(t, pp, tt.name, tt.input, tt.expectedResult, tt.expectedError)
 	}
 }
+func TestPartsSplitConventions(t *testing.T) {
+	prefixes, err := ParsePathPrefixes("api", "v1:keep", "internal:strip")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		name           string
+		options        []PathProcessorOption
+		input          string
+		expectedResult []string
+		expectedError  error
+	}{
+		{
+			"prefix keep test",
+			[]PathProcessorOption{WithPathPrefixes(prefixes...)},
+			"/v1/service-a/items",
+			[]string{"service-a", "v1", "service-a", "items"},
+			nil,
+		},
+		{
+			"prefix strip test",
+			[]PathProcessorOption{WithPathPrefixes(prefixes...)},
+			"/internal/service-a/items",
+			[]string{"service-a", "items"},
+			nil,
+		},
+		{
+			"multiple prefixes test",
+			[]PathProcessorOption{WithPathPrefixes(prefixes...)},
+			"/internal/api/service-a/items",
+			[]string{"service-a", "api", "items"},
+			nil,
+		},
+		{
+			"unknown prefix test",
+			nil,
+			"/v1/service-a/items",
+			[]string{"v1", "service-a", "items"},
+			nil,
+		},
+		{
+			"preserve case test",
+			[]PathProcessorOption{WithPathPrefixes(prefixes...), WithPreserveCase(true)},
+			"/API/Service-A/Items/ABC",
+			[]string{"service-a", "API", "Items", "ABC"},
+			nil,
+		},
+		{
+			"preserve case keep test",
+			[]PathProcessorOption{WithPathPrefixes(prefixes...), WithPreserveCase(true)},
+			"/v1/Service-A/Items",
+			[]string{"service-a", "v1", "Service-A", "Items"},
+			nil,
+		},
+		{
+			"lower case test",
+			nil,
+			"/API/Service-A/Items/ABC",
+			[]string{"service-a", "api", "items", "abc"},
+			nil,
+		},
+		{
+			"escaped path test",
+			[]PathProcessorOption{WithPreserveCase(true)},
+			"/api/Service-A/a%2Fb/%D0%BF%D1%83%D1%82%D1%8C",
+			[]string{"service-a", "api", "a%2Fb", "%D0%BF%D1%83%D1%82%D1%8C"},
+			nil,
+		},
+		{
+			"non-strict duplicate prefix test",
+			nil,
+			"/api/service/api/test",
+			[]string{"service", "api", "test"},
+			nil,
+		},
+		{
+			"strict duplicate prefix test",
+			[]PathProcessorOption{WithStrictPaths(true)},
+			"/api/service/api/test",
+			nil,
+			NewErrInvalidPath(""),
+		},
+		{
+			"strict prefix as service test",
+			[]PathProcessorOption{WithStrictPaths(true)},
+			"/api/api",
+			nil,
+			NewErrInvalidPath(""),
+		},
+		{
+			"strict empty segment test",
+			[]PathProcessorOption{WithStrictPaths(true)},
+			"/api//service/test",
+			nil,
+			NewErrInvalidPath(""),
+		},
+		{
+			"strict valid path test",
+			[]PathProcessorOption{WithStrictPaths(true)},
+			"/api/service/test",
+			[]string{"service", "api", "test"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		testPartsSplit(t, NewPathProcessor(tt.options...), tt.name, tt.input, tt.expectedResult, tt.expectedError)
+	}
+}
+func TestPathPrefix(t *testing.T) {
+	prefixes, err := ParsePathPrefixes("api", "v1:keep", "internal:strip")
+	assert.NoError(t, err)
+	pp := NewPathProcessor(WithPathPrefixes(prefixes...))
+	assert.Equal(t, "/api/service-a", pp.Prefix("/api/service-a/items"))
+	assert.Equal(t, "/api/Service-A", pp.Prefix("/api/Service-A/items/"))
+	assert.Equal(t, "/service-a", pp.Prefix("/service-a/items"))
+	assert.Equal(t, "/service-a", pp.Prefix("/service-a"))
+	assert.Equal(t, "/internal/service-a", pp.Prefix("/internal/service-a/items"))
+	assert.Equal(t, "", pp.Prefix("/v1/service-a/items"))
+	assert.Equal(t, "/internal", pp.Prefix("/internal/v1/service-a/items"))
+	assert.Equal(t, "", pp.Prefix("/api"))
+
+	target, err := pp.TargetResolve("/api/service-a/items", staticResolver{"service-a": {Scheme: "http", Host: "a", Port: 8081}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://a:8081/api/items", target.Url)
+	assert.Equal(t, "/api/service-a", target.Prefix)
+}
+func TestParsePathPrefixes(t *testing.T) {
+	for _, input := range []string{"", "api:unknown", "a/b"} {
+		if _, err := ParsePathPrefixes(input); err == nil {
+			t.Errorf("[%s] expected error, but not happened", input)
+		}
+	}
+}
 func testPartsSplit(t *testing.T, pp PathProcessor, test, input string, expectedResult []string, expectedError error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -7,7 +7,7 @@ import (
 )
 
 type ServiceResolver interface {
-	Resolve(serviceName string) (string, error)
+	Resolve(serviceName string, hint registry.Hint) (*registry.Instance, error)
 }
 
 type serviceResolverImpl struct {
@@ -15,12 +15,12 @@ type serviceResolverImpl struct {
 	logger          logging.Logger
 }
 
-func (sr *serviceResolverImpl) Resolve(serviceName string) (string, error) {
-	result, err := sr.serviceRegistry.Get(strings.ToUpper(serviceName))
+func (sr *serviceResolverImpl) Resolve(serviceName string, hint registry.Hint) (*registry.Instance, error) {
+	result, err := sr.serviceRegistry.Get(strings.ToUpper(serviceName), hint)
 	if err != nil {
 		sr.logger.Trace("%s -> %s ", serviceName, err)
 	} else {
-		sr.logger.Trace("%s -> %s ", serviceName, result)
+		sr.logger.Trace("%s -> %s ", serviceName, result.String())
 	}
 	return result, err
 }
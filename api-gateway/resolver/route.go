@@ -0,0 +1,354 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	RouteSchemeLoadBalanced = "lb"
+)
+
+// Route is a declarative routing rule: request matching all predicates is sent to
+// target service (`lb://SERVICE-A`) or literal URL with path transformed by filters
+type Route struct {
+	Id         string          `json:"id" yaml:"id"`
+	Priority   int             `json:"priority,omitempty" yaml:"priority,omitempty"` // routes with higher priority are evaluated first
+	Uri        string          `json:"uri" yaml:"uri"`
+	Predicates RoutePredicates `json:"predicates,omitempty" yaml:"predicates,omitempty"`
+	Filters    []RouteFilter   `json:"filters,omitempty" yaml:"filters,omitempty"`
+	Mirror     *Mirror         `json:"mirror,omitempty" yaml:"mirror,omitempty"`
+}
+
+// Mirror sends copies of route requests to shadow service (responses are discarded)
+type Mirror struct {
+	Service string  `json:"service" yaml:"service"`
+	Percent float64 `json:"percent,omitempty" yaml:"percent,omitempty"` // sampling percentage (default: MIRROR_PERCENT)
+	Timeout string  `json:"timeout,omitempty" yaml:"timeout,omitempty"` // mirrored request timeout (default: MIRROR_TIMEOUT)
+}
+
+// RoutePredicates are request matching conditions; all set predicates should match
+type RoutePredicates struct {
+	Path   []string          `json:"path,omitempty" yaml:"path,omitempty"`     // any of path patterns ("/api/a/**", "/a/{id}", "/a/*/b")
+	Host   []string          `json:"host,omitempty" yaml:"host,omitempty"`     // any of host patterns ("a.example.com", "*.example.com", "{sub}.example.com")
+	Method []string          `json:"method,omitempty" yaml:"method,omitempty"` // any of methods
+	Header map[string]string `json:"header,omitempty" yaml:"header,omitempty"` // header name -> value regex (empty regex - header should be present)
+	Query  map[string]string `json:"query,omitempty" yaml:"query,omitempty"`   // query param name -> value regex (empty regex - param should be present)
+}
+
+// RouteFilter is a single request transformation step; exactly one field should be set
+type RouteFilter struct {
+	StripPrefix      int          `json:"strip-prefix,omitempty" yaml:"strip-prefix,omitempty"` // number of leading path segments to remove
+	RewritePath      *RewritePath `json:"rewrite-path,omitempty" yaml:"rewrite-path,omitempty"`
+	SetPath          string       `json:"set-path,omitempty" yaml:"set-path,omitempty"` // path template; "{name}" is replaced by path or host variable
+	AddRequestHeader *HeaderValue `json:"add-request-header,omitempty" yaml:"add-request-header,omitempty"`
+	SetStatus        int          `json:"set-status,omitempty" yaml:"set-status,omitempty"` // upstream response status override
+}
+
+// RewritePath replaces path matching regex; replacement may reference capture groups ("${name}" or "$1")
+type RewritePath struct {
+	Regex       string `json:"regex" yaml:"regex"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+}
+
+// HeaderValue is a header to add to upstream request; value may reference path or host variables ("{name}")
+type HeaderValue struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// RouteMatch is a result of route evaluation for request
+type RouteMatch struct {
+	Route   *Route
+	Service string      // target service (load balanced route)
+	BaseUrl string      // target base URL (literal URL route)
+	Path    string      // path after filters applied
+	Prefix  string      // path prefix removed by StripPrefix filter
+	Headers http.Header // headers to add to upstream request
+	Status  int         // upstream response status override (0 - keep)
+	Mirror  *Mirror     // route traffic mirroring
+}
+
+// region - compiled route
+
+type routeFilterFunc func(match *RouteMatch, vars map[string]string)
+
+type compiledRoute struct {
+	route   Route
+	service string
+	baseUrl string
+	paths   []*regexp.Regexp
+	hosts   []*regexp.Regexp
+	methods []string
+	headers map[string]*regexp.Regexp
+	query   map[string]*regexp.Regexp
+	filters []routeFilterFunc
+}
+
+func compileRoute(route Route) (*compiledRoute, error) {
+	if route.Id == "" {
+		return nil, fmt.Errorf("route id not set")
+	}
+	result := compiledRoute{
+		route:   route,
+		headers: make(map[string]*regexp.Regexp),
+		query:   make(map[string]*regexp.Regexp),
+	}
+	target, err := url.Parse(route.Uri)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("route %s: invalid uri '%s'", route.Id, route.Uri)
+	}
+	switch strings.ToLower(target.Scheme) {
+	case RouteSchemeLoadBalanced:
+		result.service = strings.ToUpper(target.Host)
+	case "http", "https":
+		result.baseUrl = strings.TrimSuffix(target.String(), "/")
+	default:
+		return nil, fmt.Errorf("route %s: unsupported uri scheme '%s'", route.Id, target.Scheme)
+	}
+	for _, pattern := range route.Predicates.Path {
+		re, err := compilePattern(pattern, "/", true)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: path '%s': %w", route.Id, pattern, err)
+		}
+		result.paths = append(result.paths, re)
+	}
+	for _, pattern := range route.Predicates.Host {
+		re, err := compilePattern(strings.ToLower(pattern), ".", false)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: host '%s': %w", route.Id, pattern, err)
+		}
+		result.hosts = append(result.hosts, re)
+	}
+	for _, method := range route.Predicates.Method {
+		result.methods = append(result.methods, strings.ToUpper(strings.TrimSpace(method)))
+	}
+	for name, value := range route.Predicates.Header {
+		if result.headers[http.CanonicalHeaderKey(name)], err = compileValueRegex(value); err != nil {
+			return nil, fmt.Errorf("route %s: header %s: %w", route.Id, name, err)
+		}
+	}
+	for name, value := range route.Predicates.Query {
+		if result.query[name], err = compileValueRegex(value); err != nil {
+			return nil, fmt.Errorf("route %s: query %s: %w", route.Id, name, err)
+		}
+	}
+	if route.Mirror != nil {
+		if route.Mirror.Service == "" {
+			return nil, fmt.Errorf("route %s: mirror service not set", route.Id)
+		}
+		if route.Mirror.Percent < 0 || route.Mirror.Percent > 100 {
+			return nil, fmt.Errorf("route %s: invalid mirror percent %v", route.Id, route.Mirror.Percent)
+		}
+		if route.Mirror.Timeout != "" {
+			if _, err := time.ParseDuration(route.Mirror.Timeout); err != nil {
+				return nil, fmt.Errorf("route %s: invalid mirror timeout '%s'", route.Id, route.Mirror.Timeout)
+			}
+		}
+	}
+	for i, filter := range route.Filters {
+		f, err := compileFilter(filter)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: filter #%d: %w", route.Id, i+1, err)
+		}
+		result.filters = append(result.filters, f)
+	}
+	return &result, nil
+}
+
+// compilePattern converts path / host pattern to regex: "*" matches single segment,
+// "**" matches any number of segments, "{name}" captures single segment as variable
+func compilePattern(pattern, separator string, path bool) (*regexp.Regexp, error) {
+	segment := "[^" + regexp.QuoteMeta(separator) + "]+"
+	var sb strings.Builder
+	sb.WriteString("^")
+	parts := strings.Split(strings.TrimSpace(pattern), separator)
+	for i, part := range parts {
+		if i > 0 {
+			if path && part == "**" && i == len(parts)-1 {
+				// "/a/**" matches "/a" as well
+				sb.WriteString("(?:" + regexp.QuoteMeta(separator) + ".*)?")
+				break
+			}
+			sb.WriteString(regexp.QuoteMeta(separator))
+		}
+		switch {
+		case part == "**":
+			sb.WriteString(".*")
+		case part == "*":
+			sb.WriteString(segment)
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && len(part) > 2:
+			sb.WriteString("(?P<" + part[1:len(part)-1] + ">" + segment + ")")
+		default:
+			sb.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func compileValueRegex(value string) (*regexp.Regexp, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + value + ")$")
+}
+
+func compileFilter(filter RouteFilter) (routeFilterFunc, error) {
+	count := 0
+	var result routeFilterFunc
+	if filter.StripPrefix > 0 {
+		count++
+		n := filter.StripPrefix
+		result = func(match *RouteMatch, _ map[string]string) {
+			parts := strings.Split(strings.TrimPrefix(match.Path, "/"), "/")
+			if n >= len(parts) {
+				match.Prefix += strings.TrimSuffix(match.Path, "/")
+				match.Path = "/"
+			} else {
+				match.Prefix += "/" + strings.Join(parts[:n], "/")
+				match.Path = "/" + strings.Join(parts[n:], "/")
+			}
+		}
+	}
+	if filter.RewritePath != nil {
+		count++
+		re, err := regexp.Compile(filter.RewritePath.Regex)
+		if err != nil {
+			return nil, err
+		}
+		replacement := filter.RewritePath.Replacement
+		result = func(match *RouteMatch, _ map[string]string) {
+			match.Path = re.ReplaceAllString(match.Path, replacement)
+		}
+	}
+	if filter.SetPath != "" {
+		count++
+		template := filter.SetPath
+		result = func(match *RouteMatch, vars map[string]string) {
+			match.Path = expandVars(template, vars)
+		}
+	}
+	if filter.AddRequestHeader != nil {
+		count++
+		if filter.AddRequestHeader.Name == "" {
+			return nil, fmt.Errorf("header name not set")
+		}
+		name, value := http.CanonicalHeaderKey(filter.AddRequestHeader.Name), filter.AddRequestHeader.Value
+		result = func(match *RouteMatch, vars map[string]string) {
+			match.Headers.Add(name, expandVars(value, vars))
+		}
+	}
+	if filter.SetStatus != 0 {
+		count++
+		if filter.SetStatus < 100 || filter.SetStatus > 599 {
+			return nil, fmt.Errorf("invalid status %d", filter.SetStatus)
+		}
+		status := filter.SetStatus
+		result = func(match *RouteMatch, _ map[string]string) {
+			match.Status = status
+		}
+	}
+	if count != 1 {
+		return nil, fmt.Errorf("exactly one filter action expected, got %d", count)
+	}
+	return result, nil
+}
+
+// expandVars replaces "{name}" in template with path / host variable value
+func expandVars(template string, vars map[string]string) string {
+	for k, v := range vars {
+		template = strings.ReplaceAll(template, "{"+k+"}", v)
+	}
+	return template
+}
+
+// match evaluates route predicates for request and applies filters to the request path
+func (r *compiledRoute) match(request *http.Request) (*RouteMatch, bool) {
+	vars := make(map[string]string)
+	if len(r.methods) > 0 && !slices.Contains(r.methods, request.Method) {
+		return nil, false
+	}
+	if len(r.hosts) > 0 && !matchAny(r.hosts, virtualHostName(request), vars) {
+		return nil, false
+	}
+	// path is matched and rewritten in escaped form, so encoded characters (e.g. "%2F") are forwarded as is
+	path := request.URL.EscapedPath()
+	if len(r.paths) > 0 && !matchAny(r.paths, path, vars) {
+		return nil, false
+	}
+	for name, re := range r.headers {
+		values, ok := request.Header[name]
+		if !ok || !matchValues(re, values) {
+			return nil, false
+		}
+	}
+	if len(r.query) > 0 {
+		query := request.URL.Query()
+		for name, re := range r.query {
+			values, ok := query[name]
+			if !ok || !matchValues(re, values) {
+				return nil, false
+			}
+		}
+	}
+	match := RouteMatch{
+		Route:   &r.route,
+		Service: r.service,
+		BaseUrl: r.baseUrl,
+		Path:    path,
+		Headers: make(http.Header),
+		Mirror:  r.route.Mirror,
+	}
+	for _, filter := range r.filters {
+		filter(&match, vars)
+	}
+	if !strings.HasPrefix(match.Path, "/") {
+		match.Path = "/" + match.Path
+	}
+	return &match, true
+}
+
+func matchAny(patterns []*regexp.Regexp, value string, vars map[string]string) bool {
+	for _, re := range patterns {
+		match := re.FindStringSubmatch(value)
+		if match == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				vars[name] = match[i]
+			}
+		}
+		return true
+	}
+	return false
+}
+func matchValues(re *regexp.Regexp, values []string) bool {
+	if re == nil {
+		return true
+	}
+	for _, value := range values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHost returns lower-case request host without port
+func requestHost(request *http.Request) string {
+	host := request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// endregion
@@ -0,0 +1,249 @@
+package resolver
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// springRoute is a Spring Cloud Gateway route definition (spring.cloud.gateway.routes[])
+type springRoute struct {
+	Id         string             `yaml:"id"`
+	Uri        string             `yaml:"uri"`
+	Order      int                `yaml:"order"`
+	Predicates []springDefinition `yaml:"predicates"`
+	Filters    []springDefinition `yaml:"filters"`
+}
+
+// springDefinition is a predicate or filter definition either in shortcut ("Path=/a/**,/b/**")
+// or in fully expanded ({name: Path, args: {patterns: /a/**}}) notation
+type springDefinition struct {
+	Name string
+	Args []string
+}
+
+func (d *springDefinition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		name, args, _ := strings.Cut(node.Value, "=")
+		d.Name = strings.TrimSpace(name)
+		for _, arg := range splitShortcutArgs(d.Name, args) {
+			if arg = strings.TrimSpace(arg); arg != "" {
+				d.Args = append(d.Args, arg)
+			}
+		}
+		return nil
+	}
+	var v struct {
+		Name string    `yaml:"name"`
+		Args yaml.Node `yaml:"args"`
+	}
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	d.Name = v.Name
+	switch v.Args.Kind {
+	case yaml.MappingNode:
+		// args are taken in definition order ("_genkey_0", "_genkey_1", ... or named args)
+		for i := 0; i+1 < len(v.Args.Content); i += 2 {
+			d.Args = append(d.Args, v.Args.Content[i+1].Value)
+		}
+	case yaml.SequenceNode:
+		for _, arg := range v.Args.Content {
+			d.Args = append(d.Args, arg.Value)
+		}
+	case yaml.ScalarNode:
+		d.Args = append(d.Args, v.Args.Value)
+	}
+	return nil
+}
+
+// springShortcutArgs is the number of shortcut arguments of predicates and filters with fixed
+// arguments count; the last argument takes the rest of shortcut value (commas included)
+var springShortcutArgs = map[string]int{
+	"Header":           2,
+	"Query":            2,
+	"RewritePath":      2,
+	"StripPrefix":      1,
+	"SetPath":          1,
+	"AddRequestHeader": 2,
+	"SetStatus":        1,
+}
+
+// splitShortcutArgs splits shortcut notation arguments; regular expressions may contain commas
+// ("{m,n}" quantifiers), so RewritePath regex and replacement are split on the last comma
+func splitShortcutArgs(name, args string) []string {
+	n, ok := springShortcutArgs[name]
+	switch {
+	case !ok:
+		return strings.Split(args, ",")
+	case name == "RewritePath":
+		if i := strings.LastIndex(args, ","); i >= 0 {
+			return []string{args[:i], args[i+1:]}
+		}
+		return []string{args}
+	default:
+		return strings.SplitN(args, ",", n)
+	}
+}
+
+// isSpringConfig checks if YAML document is a Spring configuration (has top-level "spring" key)
+func isSpringConfig(data []byte) bool {
+	var v map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return false
+	}
+	_, ok := v["spring"]
+	return ok
+}
+
+// ParseSpringRoutes converts Spring Cloud Gateway route definitions (spring.cloud.gateway.routes)
+// to VOID routes. Supported predicates: Path, Host, Method, Header, Query; supported filters:
+// RewritePath, StripPrefix, SetPath, AddRequestHeader, SetStatus. Route with unsupported predicate
+// is skipped, unsupported filter is ignored; both are reported in returned warnings
+func ParseSpringRoutes(data []byte) ([]Route, []string, error) {
+	var config struct {
+		Spring struct {
+			Cloud struct {
+				Gateway struct {
+					Routes []springRoute `yaml:"routes"`
+				} `yaml:"gateway"`
+			} `yaml:"cloud"`
+		} `yaml:"spring"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+	var routes []Route
+	var warnings []string
+	for i, sr := range config.Spring.Cloud.Gateway.Routes {
+		if sr.Id == "" {
+			sr.Id = fmt.Sprintf("route-%d", i+1)
+		}
+		route, warns, err := convertSpringRoute(sr)
+		warnings = append(warnings, warns...)
+		if err == nil {
+			_, err = compileRoute(route)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("route %s skipped: %s", sr.Id, err))
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, warnings, nil
+}
+
+func convertSpringRoute(sr springRoute) (Route, []string, error) {
+	route := Route{
+		Id:       sr.Id,
+		Priority: -sr.Order, // lower order is evaluated first
+		Uri:      sr.Uri,
+	}
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, p := range sr.Predicates {
+		if seen[p.Name] && slices.Contains([]string{"Path", "Host", "Method"}, p.Name) {
+			warnings = append(warnings, fmt.Sprintf("route %s: multiple %s predicates are merged (any of values matches)", sr.Id, p.Name))
+		}
+		seen[p.Name] = true
+		switch p.Name {
+		case "Path":
+			route.Predicates.Path = append(route.Predicates.Path, p.Args...)
+		case "Host":
+			route.Predicates.Host = append(route.Predicates.Host, p.Args...)
+		case "Method":
+			route.Predicates.Method = append(route.Predicates.Method, p.Args...)
+		case "Header", "Query":
+			if len(p.Args) == 0 || len(p.Args) > 2 {
+				return route, warnings, fmt.Errorf("invalid %s predicate arguments: %v", p.Name, p.Args)
+			}
+			value := ""
+			if len(p.Args) == 2 {
+				value = p.Args[1]
+			}
+			if p.Name == "Header" {
+				if route.Predicates.Header == nil {
+					route.Predicates.Header = make(map[string]string)
+				}
+				route.Predicates.Header[p.Args[0]] = value
+			} else {
+				if route.Predicates.Query == nil {
+					route.Predicates.Query = make(map[string]string)
+				}
+				route.Predicates.Query[p.Args[0]] = value
+			}
+		default:
+			return route, warnings, fmt.Errorf("unsupported predicate '%s'", p.Name)
+		}
+	}
+	for _, f := range sr.Filters {
+		filter, err := convertSpringFilter(f)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("route %s: filter %s ignored: %s", sr.Id, f.Name, err))
+			continue
+		}
+		route.Filters = append(route.Filters, filter)
+	}
+	return route, warnings, nil
+}
+
+func convertSpringFilter(f springDefinition) (RouteFilter, error) {
+	var filter RouteFilter
+	switch f.Name {
+	case "RewritePath":
+		if len(f.Args) != 2 {
+			return filter, fmt.Errorf("regex and replacement expected")
+		}
+		// "$\{segment}" is YAML-friendly Spring notation for "${segment}"
+		filter.RewritePath = &RewritePath{Regex: f.Args[0], Replacement: strings.ReplaceAll(f.Args[1], "$\\", "$")}
+	case "StripPrefix":
+		n := 1
+		if len(f.Args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(f.Args[0]); err != nil || n < 1 {
+				return filter, fmt.Errorf("invalid parts count '%s'", f.Args[0])
+			}
+		}
+		filter.StripPrefix = n
+	case "SetPath":
+		if len(f.Args) != 1 {
+			return filter, fmt.Errorf("path template expected")
+		}
+		filter.SetPath = f.Args[0]
+	case "AddRequestHeader":
+		if len(f.Args) != 2 {
+			return filter, fmt.Errorf("header name and value expected")
+		}
+		filter.AddRequestHeader = &HeaderValue{Name: f.Args[0], Value: f.Args[1]}
+	case "SetStatus":
+		if len(f.Args) != 1 {
+			return filter, fmt.Errorf("status expected")
+		}
+		status, err := parseSpringStatus(f.Args[0])
+		if err != nil {
+			return filter, err
+		}
+		filter.SetStatus = status
+	default:
+		return filter, fmt.Errorf("unsupported filter")
+	}
+	return filter, nil
+}
+
+// parseSpringStatus parses status code or Spring HttpStatus name ("NOT_FOUND")
+func parseSpringStatus(value string) (int, error) {
+	if status, err := strconv.Atoi(value); err == nil {
+		return status, nil
+	}
+	name := strings.ToUpper(value)
+	for status := 100; status < 600; status++ {
+		text := strings.NewReplacer(" ", "_", "-", "_", "'", "_").Replace(strings.ToUpper(http.StatusText(status)))
+		if text != "" && text == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status '%s'", value)
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadSpringRoutes(t *testing.T) {
+	table, err := LoadRoutes("../../app/run/routes/routes.yml")
+	assert.NoError(t, err)
+	assert.Len(t, table.Routes(), 2)
+	for input, expected := range map[string]string{
+		"/api/service-a/items/1": "/api/items/1",
+		"/service-b/api/items":   "/api/items",
+	} {
+		match, ok := table.Match(httptest.NewRequest("GET", input, nil))
+		if assert.True(t, ok, input) {
+			assert.Equal(t, expected, match.Path, input)
+		}
+	}
+}
+
+func TestParseSpringRoutes(t *testing.T) {
+	routes, warnings, err := ParseSpringRoutes([]byte(`
+spring:
+  application:
+    name: gateway
+  cloud:
+    gateway:
+      routes:
+        - id: tenants
+          uri: lb://SERVICE-A
+          order: 1
+          predicates:
+            - Host={tenant}.example.com
+            - Path=/items/{id}
+            - Method=GET,POST
+            - Header=X-Request-Id, \d+
+            - Query=debug
+          filters:
+            - SetPath=/tenants/{tenant}/items/{id}
+            - AddRequestHeader=X-Tenant, {tenant}
+            - SetStatus=ACCEPTED
+            - name: StripPrefix
+              args:
+                parts: 1
+            - PreserveHostHeader
+        - id: cookie
+          uri: lb://SERVICE-B
+          predicates:
+            - Cookie=chocolate, ch.p
+        - id: forward
+          uri: forward:/local
+          predicates:
+            - Path=/local/**
+        - id: legacy
+          uri: http://legacy:8080
+          order: 2
+          predicates:
+            - name: Path
+              args:
+                _genkey_0: /legacy/**
+          filters:
+            - SetStatus=499
+`))
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 3)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, Route{
+			Id:       "tenants",
+			Priority: -1,
+			Uri:      "lb://SERVICE-A",
+			Predicates: RoutePredicates{
+				Path:   []string{"/items/{id}"},
+				Host:   []string{"{tenant}.example.com"},
+				Method: []string{"GET", "POST"},
+				Header: map[string]string{"X-Request-Id": `\d+`},
+				Query:  map[string]string{"debug": ""},
+			},
+			Filters: []RouteFilter{
+				{SetPath: "/tenants/{tenant}/items/{id}"},
+				{AddRequestHeader: &HeaderValue{Name: "X-Tenant", Value: "{tenant}"}},
+				{SetStatus: http.StatusAccepted},
+				{StripPrefix: 1},
+			},
+		}, routes[0])
+		assert.Equal(t, []string{"/legacy/**"}, routes[1].Predicates.Path)
+		assert.Equal(t, []RouteFilter{{SetStatus: 499}}, routes[1].Filters)
+	}
+
+	table, err := NewRouteTable(routes...)
+	assert.NoError(t, err)
+	request := httptest.NewRequest("POST", "http://acme.example.com/items/42?debug=1", nil)
+	request.Header.Set("X-Request-Id", "123")
+	match, ok := table.Match(request)
+	if assert.True(t, ok) {
+		assert.Equal(t, "/acme/items/42", match.Path)
+		assert.Equal(t, "acme", match.Headers.Get("X-Tenant"))
+		assert.Equal(t, http.StatusAccepted, match.Status)
+	}
+}
+
+func TestParseSpringRoutesShortcutArgs(t *testing.T) {
+	routes, warnings, err := ParseSpringRoutes([]byte(`
+spring:
+  cloud:
+    gateway:
+      routes:
+        - id: versions
+          uri: lb://SERVICE-A
+          predicates:
+            - Path=/{version}/**
+            - Header=X-Request-Id, \d{2,4}
+          filters:
+            - RewritePath=/v(?<version>\d{1,3})/(?<path>.*), /api/$\{version}/$\{path}
+            - AddRequestHeader=X-Tags, a,b
+`))
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, map[string]string{"X-Request-Id": `\d{2,4}`}, routes[0].Predicates.Header)
+		assert.Equal(t, []RouteFilter{
+			{RewritePath: &RewritePath{Regex: `/v(?<version>\d{1,3})/(?<path>.*)`, Replacement: "/api/${version}/${path}"}},
+			{AddRequestHeader: &HeaderValue{Name: "X-Tags", Value: "a,b"}},
+		}, routes[0].Filters)
+	}
+
+	table, err := NewRouteTable(routes...)
+	assert.NoError(t, err)
+	request := httptest.NewRequest("GET", "/v12/items/1", nil)
+	request.Header.Set("X-Request-Id", "123")
+	match, ok := table.Match(request)
+	if assert.True(t, ok) {
+		assert.Equal(t, "/api/12/items/1", match.Path)
+	}
+}
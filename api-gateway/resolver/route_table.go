@@ -0,0 +1,149 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/slink-go/logging"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RouteTable evaluates declarative routes by priority (routes with equal priority
+// are evaluated in configuration order); first matching route wins
+type RouteTable struct {
+	mutex  sync.RWMutex
+	routes []*compiledRoute
+}
+
+func NewRouteTable(routes ...Route) (*RouteTable, error) {
+	table := RouteTable{}
+	if err := table.Set(routes...); err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// LoadRoutes reads route table from YAML or JSON file (list of routes);
+// YAML file can also contain Spring Cloud Gateway configuration (see ParseSpringRoutes)
+func LoadRoutes(path string) (*RouteTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if strings.HasSuffix(path, "yml") || strings.HasSuffix(path, "yaml") {
+		if isSpringConfig(data) {
+			// Spring Cloud Gateway routes
+			var warnings []string
+			routes, warnings, err = ParseSpringRoutes(data)
+			for _, warning := range warnings {
+				logging.GetLogger("route-loader").Warning("%s: %s", path, warning)
+			}
+		} else {
+			err = yaml.Unmarshal(data, &routes)
+		}
+	} else if strings.HasSuffix(path, "json") {
+		err = json.Unmarshal(data, &routes)
+	} else {
+		err = fmt.Errorf("unsupported file type: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewRouteTable(routes...)
+}
+
+// Set replaces table routes; table is left unchanged if any route is invalid
+func (t *RouteTable) Set(routes ...Route) error {
+	compiled := make([]*compiledRoute, 0, len(routes))
+	ids := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		if _, ok := ids[route.Id]; ok {
+			return fmt.Errorf("duplicate route id: %s", route.Id)
+		}
+		ids[route.Id] = struct{}{}
+		c, err := compileRoute(route)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+	slices.SortStableFunc(compiled, func(a, b *compiledRoute) int {
+		return b.route.Priority - a.route.Priority
+	})
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.routes = compiled
+	return nil
+}
+
+// Routes returns table routes in evaluation order
+func (t *RouteTable) Routes() []Route {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	result := make([]Route, 0, len(t.routes))
+	for _, r := range t.routes {
+		result = append(result, r.route)
+	}
+	return result
+}
+
+// Match returns first route matching request
+func (t *RouteTable) Match(request *http.Request) (*RouteMatch, bool) {
+	if t == nil {
+		return nil, false
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, r := range t.routes {
+		if match, ok := r.match(request); ok {
+			return match, true
+		}
+	}
+	return nil, false
+}
+
+// TargetResolve resolves request to proxy target using matching route;
+// returns nil target (and no error) if no route matches the request
+func (t *RouteTable) TargetResolve(request *http.Request, resolver ServiceResolver, hint HintFunc) (*Target, error) {
+	match, ok := t.Match(request)
+	if !ok {
+		return nil, nil
+	}
+	if match.Service == "" {
+		return &Target{
+			Route:   match.Route.Id,
+			Url:     match.BaseUrl + match.Path,
+			Prefix:  match.Prefix,
+			Headers: match.Headers,
+			Status:  match.Status,
+			Mirror:  match.Mirror,
+		}, nil
+	}
+	var h registry.Hint
+	if hint != nil {
+		h = hint(match.Service)
+	}
+	instance, err := resolver.Resolve(match.Service, h)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, registry.NewErrServiceUnavailable(match.Service)
+	}
+	return &Target{
+		Service:  match.Service,
+		Instance: instance,
+		Route:    match.Route.Id,
+		Url:      instance.String() + match.Path,
+		Prefix:   match.Prefix,
+		Headers:  match.Headers,
+		Status:   match.Status,
+		Mirror:   match.Mirror,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package resolver
+
+import (
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type staticResolver map[string]discovery.Remote
+
+func (r staticResolver) Resolve(serviceName string, _ registry.Hint) (*registry.Instance, error) {
+	remote, ok := r[serviceName]
+	if !ok {
+		return nil, registry.NewErrServiceUnavailable(serviceName)
+	}
+	return &registry.Instance{Remote: remote}, nil
+}
+
+func TestRouteTable(t *testing.T) {
+	table, err := NewRouteTable(
+		Route{
+			Id:  "catch-all",
+			Uri: "http://legacy:8080/base/",
+			Predicates: RoutePredicates{
+				Path: []string{"/**"},
+			},
+		},
+		Route{
+			Id:       "service-a-v2",
+			Priority: 10,
+			Uri:      "lb://service-a",
+			Predicates: RoutePredicates{
+				Path:   []string{"/api/v2/service-a/**"},
+				Method: []string{"get"},
+				Header: map[string]string{"x-version": "2|3"},
+			},
+			Filters: []RouteFilter{
+				{RewritePath: &RewritePath{Regex: "^/api/v2/service-a/(?P<rest>.*)$", Replacement: "/v2/${rest}"}},
+			},
+		},
+		Route{
+			Id:       "service-a",
+			Priority: 5,
+			Uri:      "lb://SERVICE-A",
+			Predicates: RoutePredicates{
+				Path: []string{"/api/service-a/**", "/service-a/api/**"},
+			},
+			Filters: []RouteFilter{
+				{StripPrefix: 2},
+			},
+		},
+		Route{
+			Id:       "items",
+			Priority: 5,
+			Uri:      "lb://SERVICE-B",
+			Predicates: RoutePredicates{
+				Host:  []string{"{tenant}.example.com"},
+				Path:  []string{"/items/{id}"},
+				Query: map[string]string{"debug": ""},
+			},
+			Filters: []RouteFilter{
+				{SetPath: "/tenants/{tenant}/items/{id}"},
+			},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "service-a-v2", table.Routes()[0].Id)
+	assert.Equal(t, "catch-all", table.Routes()[3].Id)
+
+	resolver := staticResolver{
+		"SERVICE-A": {Scheme: "http", Host: "a", Port: 8081},
+		"SERVICE-B": {Scheme: "http", Host: "b", Port: 8082},
+	}
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		header map[string]string
+		route  string
+		target string
+	}{
+		{"header predicate", "GET", "/api/v2/service-a/items/1", map[string]string{"X-Version": "3"}, "service-a-v2", "http://a:8081/v2/items/1"},
+		{"header mismatch", "GET", "/api/v2/service-a/items/1", map[string]string{"X-Version": "4"}, "catch-all", "http://legacy:8080/base/api/v2/service-a/items/1"},
+		{"method mismatch", "POST", "/api/v2/service-a/items/1", map[string]string{"X-Version": "2"}, "catch-all", "http://legacy:8080/base/api/v2/service-a/items/1"},
+		{"strip prefix", "GET", "/service-a/api/items", nil, "service-a", "http://a:8081/items"},
+		{"strip whole path", "GET", "/service-a/api", nil, "service-a", "http://a:8081/"},
+		{"host and path variables", "GET", "http://acme.example.com:8080/items/42?debug", nil, "items", "http://b:8082/tenants/acme/items/42"},
+		{"query mismatch", "GET", "http://acme.example.com/items/42", nil, "catch-all", "http://legacy:8080/base/items/42"},
+		{"literal url", "GET", "/other/path", nil, "catch-all", "http://legacy:8080/base/other/path"},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(tt.method, tt.url, nil)
+		for k, v := range tt.header {
+			request.Header.Set(k, v)
+		}
+		target, err := table.TargetResolve(request, resolver, nil)
+		if assert.NoError(t, err, tt.name) && assert.NotNil(t, target, tt.name) {
+			assert.Equal(t, tt.route, target.Route, tt.name)
+			assert.Equal(t, tt.target, target.Url, tt.name)
+		}
+	}
+
+	// path prefix removed by StripPrefix filter
+	target, err := table.TargetResolve(httptest.NewRequest("GET", "/service-a/api/items", nil), resolver, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/service-a/api", target.Prefix)
+
+	// unavailable service
+	table, _ = NewRouteTable(Route{Id: "c", Uri: "lb://SERVICE-C"})
+	_, err = table.TargetResolve(httptest.NewRequest("GET", "/x", nil), resolver, nil)
+	assert.ErrorIs(t, err, registry.NewErrServiceUnavailable("SERVICE-C"))
+
+	// no match
+	table, _ = NewRouteTable()
+	target, err = table.TargetResolve(httptest.NewRequest("GET", "/x", nil), resolver, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, target)
+}
+
+func TestRouteValidation(t *testing.T) {
+	invalid := []Route{
+		{Uri: "lb://A"},
+		{Id: "a", Uri: "ftp://a"},
+		{Id: "a", Uri: "SERVICE-A"},
+		{Id: "a", Uri: "lb://A", Predicates: RoutePredicates{Header: map[string]string{"a": "("}}},
+		{Id: "a", Uri: "lb://A", Filters: []RouteFilter{{}}},
+		{Id: "a", Uri: "lb://A", Filters: []RouteFilter{{StripPrefix: 1, SetPath: "/"}}},
+		{Id: "a", Uri: "lb://A", Filters: []RouteFilter{{RewritePath: &RewritePath{Regex: "("}}}},
+	}
+	for _, route := range invalid {
+		_, err := NewRouteTable(route)
+		assert.Error(t, err, route)
+	}
+	_, err := NewRouteTable(Route{Id: "a", Uri: "lb://A"}, Route{Id: "a", Uri: "lb://B"})
+	assert.Error(t, err)
+}
+
+func TestLoadRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+- id: service-a
+  uri: lb://SERVICE-A
+  predicates:
+    path: [/api/service-a/**]
+  filters:
+    - rewrite-path:
+        regex: /api/service-a/(?<segment>.*)
+        replacement: /api/${segment}
+`), 0644))
+	table, err := LoadRoutes(path)
+	assert.NoError(t, err)
+	match, ok := table.Match(httptest.NewRequest("GET", "/api/service-a/items", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "SERVICE-A", match.Service)
+	assert.Equal(t, "/api/items", match.Path)
+}
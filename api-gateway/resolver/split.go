@@ -0,0 +1,267 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slink-go/api-gateway/registry"
+	"gopkg.in/yaml.v3"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TrafficSplit distributes requests to service between weighted backends: instance
+// subsets (by instance version) and / or alternative services
+type TrafficSplit struct {
+	Service  string         `json:"service" yaml:"service"`
+	Backends []SplitBackend `json:"backends" yaml:"backends"`
+}
+
+type SplitBackend struct {
+	Name     string         `json:"name" yaml:"name"`
+	Service  string         `json:"service,omitempty" yaml:"service,omitempty"` // alternative service (default: split service)
+	Version  string         `json:"version,omitempty" yaml:"version,omitempty"` // instance subset (instance metadata "version")
+	Weight   int            `json:"weight" yaml:"weight"`
+	Override *SplitOverride `json:"override,omitempty" yaml:"override,omitempty"`
+}
+
+// SplitOverride forces backend selection by request header or cookie (e.g. "X-Canary: true");
+// empty value means header / cookie should be present
+type SplitOverride struct {
+	Header map[string]string `json:"header,omitempty" yaml:"header,omitempty"`
+	Cookie map[string]string `json:"cookie,omitempty" yaml:"cookie,omitempty"`
+}
+
+// TrafficSplitter keeps traffic split configuration (weights can be changed at runtime)
+type TrafficSplitter struct {
+	mutex  sync.RWMutex
+	splits map[string]TrafficSplit
+}
+
+func NewTrafficSplitter(splits ...TrafficSplit) (*TrafficSplitter, error) {
+	result := TrafficSplitter{
+		splits: make(map[string]TrafficSplit, len(splits)),
+	}
+	for _, split := range splits {
+		split.Service = strings.ToUpper(strings.TrimSpace(split.Service))
+		if _, ok := result.splits[split.Service]; ok {
+			return nil, fmt.Errorf("duplicate traffic split for %s", split.Service)
+		}
+		if err := split.validate(); err != nil {
+			return nil, err
+		}
+		result.splits[split.Service] = split
+	}
+	return &result, nil
+}
+
+// LoadTrafficSplits reads traffic splits from YAML or JSON file (list of splits)
+func LoadTrafficSplits(path string) (*TrafficSplitter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var splits []TrafficSplit
+	if strings.HasSuffix(path, "yml") || strings.HasSuffix(path, "yaml") {
+		err = yaml.Unmarshal(data, &splits)
+	} else if strings.HasSuffix(path, "json") {
+		err = json.Unmarshal(data, &splits)
+	} else {
+		err = fmt.Errorf("unsupported file type: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewTrafficSplitter(splits...)
+}
+
+func (s TrafficSplit) validate() error {
+	if s.Service == "" {
+		return fmt.Errorf("traffic split service not set")
+	}
+	if len(s.Backends) == 0 {
+		return fmt.Errorf("traffic split %s: no backends", s.Service)
+	}
+	names := make(map[string]struct{}, len(s.Backends))
+	total := 0
+	for _, b := range s.Backends {
+		if b.Name == "" {
+			return fmt.Errorf("traffic split %s: backend name not set", s.Service)
+		}
+		if _, ok := names[b.Name]; ok {
+			return fmt.Errorf("traffic split %s: duplicate backend %s", s.Service, b.Name)
+		}
+		names[b.Name] = struct{}{}
+		if b.Weight < 0 {
+			return fmt.Errorf("traffic split %s: backend %s: negative weight", s.Service, b.Name)
+		}
+		total += b.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("traffic split %s: total weight is zero", s.Service)
+	}
+	return nil
+}
+
+// Splits returns current traffic splits
+func (t *TrafficSplitter) Splits() []TrafficSplit {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	result := make([]TrafficSplit, 0, len(t.splits))
+	for _, split := range t.splits {
+		result = append(result, split)
+	}
+	slices.SortFunc(result, func(a, b TrafficSplit) int {
+		return strings.Compare(a.Service, b.Service)
+	})
+	return result
+}
+
+// SetWeights changes backend weights of service traffic split ("{backend}: {weight}");
+// backends which are not mentioned keep their weights
+func (t *TrafficSplitter) SetWeights(service string, weights map[string]int) (TrafficSplit, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	split, ok := t.splits[strings.ToUpper(service)]
+	if !ok {
+		return split, NewErrUnknownTrafficSplit(service)
+	}
+	split.Backends = slices.Clone(split.Backends)
+	for name, weight := range weights {
+		i := slices.IndexFunc(split.Backends, func(b SplitBackend) bool { return b.Name == name })
+		if i < 0 {
+			return split, fmt.Errorf("traffic split %s: unknown backend %s", split.Service, name)
+		}
+		split.Backends[i].Weight = weight
+	}
+	if err := split.validate(); err != nil {
+		return split, err
+	}
+	t.splits[split.Service] = split
+	return split, nil
+}
+
+// Resolver returns service resolver applying traffic splits for the request
+func (t *TrafficSplitter) Resolver(next ServiceResolver, request *http.Request) ServiceResolver {
+	return &splitResolver{
+		splitter: t,
+		next:     next,
+		request:  request,
+	}
+}
+
+func (t *TrafficSplitter) get(service string) (TrafficSplit, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	split, ok := t.splits[strings.ToUpper(service)]
+	return split, ok
+}
+
+// region - resolver
+
+type splitResolver struct {
+	splitter *TrafficSplitter
+	next     ServiceResolver
+	request  *http.Request
+	chosen   map[string]SplitBackend // backends which served the request, by service (retries stay on them)
+}
+
+func (r *splitResolver) Resolve(serviceName string, hint registry.Hint) (*registry.Instance, error) {
+	split, ok := r.splitter.get(serviceName)
+	if !ok {
+		return r.next.Resolve(serviceName, hint)
+	}
+	if b, ok := r.chosen[split.Service]; ok {
+		return r.resolve(split, b, hint)
+	}
+	// chosen backend is tried first; if it has no available instances, others are tried by weight
+	chosen := split.choose(r.request, hint.HashKey)
+	candidates := []SplitBackend{split.Backends[chosen]}
+	rest := slices.Delete(slices.Clone(split.Backends), chosen, chosen+1)
+	slices.SortStableFunc(rest, func(a, b SplitBackend) int { return b.Weight - a.Weight })
+	for _, b := range rest {
+		if b.Weight > 0 {
+			candidates = append(candidates, b)
+		}
+	}
+	var err error
+	for _, b := range candidates {
+		var instance *registry.Instance
+		if instance, err = r.resolve(split, b, hint); err == nil {
+			if !hint.DryRun {
+				if r.chosen == nil {
+					r.chosen = make(map[string]SplitBackend)
+				}
+				r.chosen[split.Service] = b
+			}
+			return instance, nil
+		}
+		if !errors.Is(err, registry.NewErrServiceUnavailable(split.Service)) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// resolve resolves instance of split backend (backend service or split service instance of backend version)
+func (r *splitResolver) resolve(split TrafficSplit, b SplitBackend, hint registry.Hint) (*registry.Instance, error) {
+	service := b.Service
+	if service == "" {
+		service = split.Service
+	}
+	hint.Version = b.Version
+	return r.next.Resolve(service, hint)
+}
+
+// choose returns backend index: backend with matching override, or weighted choice
+// (deterministic for requests with hash key, so client sticks to the same backend)
+func (s TrafficSplit) choose(request *http.Request, key string) int {
+	for i, b := range s.Backends {
+		if b.Override != nil && b.Override.matches(request) {
+			return i
+		}
+	}
+	total := 0
+	for _, b := range s.Backends {
+		total += b.Weight
+	}
+	var n int
+	if key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for i, b := range s.Backends {
+		if n < b.Weight {
+			return i
+		}
+		n -= b.Weight
+	}
+	return len(s.Backends) - 1
+}
+
+func (o *SplitOverride) matches(request *http.Request) bool {
+	if request == nil {
+		return false
+	}
+	for name, value := range o.Header {
+		if v := request.Header.Get(name); v != "" && (value == "" || strings.EqualFold(v, value)) {
+			return true
+		}
+	}
+	for name, value := range o.Cookie {
+		if c, err := request.Cookie(name); err == nil && (value == "" || strings.EqualFold(c.Value, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// endregion
@@ -0,0 +1,100 @@
+package resolver
+
+import (
+	"github.com/slink-go/api-gateway/discovery"
+	"github.com/slink-go/api-gateway/registry"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// versionResolver resolves service instances by version
+type versionResolver map[string]map[string]discovery.Remote
+
+func (r versionResolver) Resolve(serviceName string, hint registry.Hint) (*registry.Instance, error) {
+	remote, ok := r[serviceName][hint.Version]
+	if !ok {
+		return nil, registry.NewErrServiceUnavailable(serviceName)
+	}
+	return &registry.Instance{Remote: remote}, nil
+}
+
+func TestTrafficSplit(t *testing.T) {
+	splitter, err := NewTrafficSplitter(TrafficSplit{
+		Service: "service-a",
+		Backends: []SplitBackend{
+			{Name: "stable", Version: "v1", Weight: 95},
+			{Name: "canary", Version: "v2", Weight: 5, Override: &SplitOverride{
+				Header: map[string]string{"X-Canary": "true"},
+				Cookie: map[string]string{"canary": ""},
+			}},
+			{Name: "rewrite", Service: "SERVICE-B", Weight: 0},
+		},
+	})
+	assert.NoError(t, err)
+	next := versionResolver{
+		"SERVICE-A": {
+			"v1": {App: "SERVICE-A", Host: "a1", Version: "v1"},
+			"v2": {App: "SERVICE-A", Host: "a2", Version: "v2"},
+		},
+		"SERVICE-B": {
+			"": {App: "SERVICE-B", Host: "b"},
+		},
+		"SERVICE-C": {
+			"": {App: "SERVICE-C", Host: "c"},
+		},
+	}
+	resolve := func(request *http.Request, hint registry.Hint) string {
+		instance, err := splitter.Resolver(next, request).Resolve("service-a", hint)
+		assert.NoError(t, err)
+		return instance.Version
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		counts[resolve(httptest.NewRequest("GET", "/", nil), registry.Hint{})]++
+	}
+	assert.InDelta(t, 1900, counts["v1"], 60)
+	assert.InDelta(t, 100, counts["v2"], 60)
+
+	// override
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Canary", "TRUE")
+	assert.Equal(t, "v2", resolve(request, registry.Hint{}))
+	request = httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(&http.Cookie{Name: "canary", Value: "1"})
+	assert.Equal(t, "v2", resolve(request, registry.Hint{}))
+
+	// hash key sticks to the same backend
+	first := resolve(httptest.NewRequest("GET", "/", nil), registry.Hint{HashKey: "user-1"})
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, resolve(httptest.NewRequest("GET", "/", nil), registry.Hint{HashKey: "user-1"}))
+	}
+
+	// services without split are resolved as is
+	instance, err := splitter.Resolver(next, nil).Resolve("SERVICE-C", registry.Hint{})
+	assert.NoError(t, err)
+	assert.Equal(t, "c", instance.Host)
+
+	// runtime weights change; chosen backend without instances falls back to others
+	_, err = splitter.SetWeights("SERVICE-A", map[string]int{"stable": 0, "canary": 0, "rewrite": 1})
+	assert.NoError(t, err)
+	instance, err = splitter.Resolver(next, nil).Resolve("SERVICE-A", registry.Hint{})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", instance.Host)
+	delete(next, "SERVICE-B")
+	_, err = splitter.Resolver(next, nil).Resolve("SERVICE-A", registry.Hint{})
+	assert.ErrorIs(t, err, registry.NewErrServiceUnavailable(""))
+	_, err = splitter.SetWeights("SERVICE-A", map[string]int{"stable": 1, "canary": 1})
+	assert.NoError(t, err)
+	_, err = splitter.Resolver(next, nil).Resolve("SERVICE-A", registry.Hint{})
+	assert.NoError(t, err)
+
+	_, err = splitter.SetWeights("SERVICE-A", map[string]int{"unknown": 1})
+	assert.Error(t, err)
+	_, err = splitter.SetWeights("SERVICE-A", map[string]int{"stable": 0, "canary": 0, "rewrite": 0})
+	assert.Error(t, err)
+	_, err = splitter.SetWeights("SERVICE-X", map[string]int{"stable": 1})
+	assert.ErrorIs(t, err, NewErrUnknownTrafficSplit(""))
+}
@@ -0,0 +1,122 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/slink-go/api-gateway/registry"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// VirtualHosts maps request host to service: "a.example.com" -> SERVICE-A;
+// host pattern may capture subdomain as service name ("{svc}.api.example.com" -> "{svc}")
+type VirtualHosts struct {
+	hosts []virtualHost
+}
+
+type virtualHost struct {
+	pattern string
+	re      *regexp.Regexp
+	service string // service name template
+	exact   bool
+}
+
+// NewVirtualHosts parses virtual hosts config: list of "{host pattern}={service}" items;
+// exact host names take precedence over patterns, patterns are evaluated in config order
+func NewVirtualHosts(items ...string) (*VirtualHosts, error) {
+	result := VirtualHosts{}
+	for _, item := range items {
+		pattern, service, ok := strings.Cut(item, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		service = strings.TrimSpace(service)
+		if !ok || pattern == "" || service == "" {
+			return nil, fmt.Errorf("invalid virtual host config '%s'", item)
+		}
+		re, err := compilePattern(pattern, ".", false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid virtual host pattern '%s': %w", pattern, err)
+		}
+		result.hosts = append(result.hosts, virtualHost{
+			pattern: pattern,
+			re:      re,
+			service: service,
+			exact:   !strings.ContainsAny(pattern, "*{"),
+		})
+	}
+	slices.SortStableFunc(result.hosts, func(a, b virtualHost) int {
+		switch {
+		case a.exact == b.exact:
+			return 0
+		case a.exact:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return &result, nil
+}
+
+// Service returns service name bound to request host
+func (v *VirtualHosts) Service(request *http.Request) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	host := virtualHostName(request)
+	if host == "" {
+		return "", false
+	}
+	for _, vh := range v.hosts {
+		vars := make(map[string]string)
+		if !matchAny([]*regexp.Regexp{vh.re}, host, vars) {
+			continue
+		}
+		return strings.ToUpper(expandVars(vh.service, vars)), true
+	}
+	return "", false
+}
+
+// TargetResolve resolves request to the service bound to request host; path conventions
+// still apply within virtual host (service prefix is removed if present), other paths are
+// forwarded as is. Returns nil target (and no error) if request host is not bound to any service
+func (v *VirtualHosts) TargetResolve(request *http.Request, pathProcessor PathProcessor, resolver ServiceResolver, hint HintFunc) (*Target, error) {
+	service, ok := v.Service(request)
+	if !ok {
+		return nil, nil
+	}
+	var h registry.Hint
+	if hint != nil {
+		h = hint(service)
+	}
+	instance, err := resolver.Resolve(service, h)
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, registry.NewErrServiceUnavailable(service)
+	}
+	target := Target{
+		Service:  service,
+		Instance: instance,
+		Url:      instance.String() + request.URL.EscapedPath(),
+	}
+	if parts, err := pathProcessor.Split(request.URL.EscapedPath()); err == nil && strings.EqualFold(parts[0], service) {
+		if target.Url, err = pathProcessor.Join(instance.String(), parts); err != nil {
+			return nil, err
+		}
+		target.Url = keepTrailingSlash(request.URL.EscapedPath(), target.Url)
+		target.Prefix = pathProcessor.Prefix(request.URL.EscapedPath())
+	}
+	return &target, nil
+}
+
+// virtualHostName returns request host name: Host header, or TLS server name (SNI)
+// if Host header is not set or contains IP address
+func virtualHostName(request *http.Request) string {
+	host := requestHost(request)
+	if request.TLS != nil && request.TLS.ServerName != "" && (host == "" || net.ParseIP(strings.Trim(host, "[]")) != nil) {
+		return strings.ToLower(request.TLS.ServerName)
+	}
+	return host
+}
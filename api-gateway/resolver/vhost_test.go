@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVirtualHosts(t *testing.T) {
+	vhosts, err := NewVirtualHosts("{svc}.api.example.com={svc}", "*.example.com=service-b", "a.example.com=SERVICE-A")
+	assert.NoError(t, err)
+	resolver := staticResolver{
+		"SERVICE-A": {Scheme: "http", Host: "a", Port: 8081},
+		"SERVICE-B": {Scheme: "http", Host: "b", Port: 8082},
+	}
+	tests := []struct {
+		url    string
+		target string
+	}{
+		{"http://a.example.com/Items/1", "http://a:8081/Items/1"},
+		{"http://A.Example.com:8080/api/service-a/items", "http://a:8081/api/items"},
+		{"http://a.example.com/service-a/api/items", "http://a:8081/api/items"},
+		{"http://a.example.com/api/items", "http://a:8081/api/items"},
+		{"http://service-b.api.example.com/x", "http://b:8082/x"},
+		{"http://other.example.com/x", "http://b:8082/x"},
+	}
+	pp := NewPathProcessor()
+	for _, tt := range tests {
+		target, err := vhosts.TargetResolve(httptest.NewRequest("GET", tt.url, nil), pp, resolver, nil)
+		if assert.NoError(t, err, tt.url) && assert.NotNil(t, target, tt.url) {
+			assert.Equal(t, tt.target, target.Url, tt.url)
+		}
+	}
+
+	// unknown service
+	_, err = vhosts.TargetResolve(httptest.NewRequest("GET", "http://service-c.api.example.com/x", nil), pp, resolver, nil)
+	assert.Error(t, err)
+
+	// host is not bound
+	target, err := vhosts.TargetResolve(httptest.NewRequest("GET", "http://example.org/x", nil), pp, resolver, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, target)
+
+	// SNI is used if Host is an IP address
+	request := httptest.NewRequest("GET", "http://10.0.0.1/x", nil)
+	request.TLS = &tls.ConnectionState{ServerName: "a.example.com"}
+	service, ok := vhosts.Service(request)
+	assert.True(t, ok)
+	assert.Equal(t, "SERVICE-A", service)
+
+	_, err = NewVirtualHosts("a.example.com")
+	assert.Error(t, err)
+}